@@ -16,7 +16,24 @@ func init() {
 	vips.Startup(nil)
 }
 
+// commands - подкоманды. Без подкоманды запускается сервер.
+var commands = map[string]func(args []string) error{
+	"warm":   runWarm,
+	"render": runRender,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			err := command(os.Args[2:])
+			vips.Shutdown()
+			if err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	path, err := config.ParseFlags()
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/IKolyas/thumbnailer/internal/app"
+	"github.com/IKolyas/thumbnailer/internal/config"
+	"github.com/IKolyas/thumbnailer/internal/core/image"
+)
+
+// renderFlags - параметры обработки команды render.
+type renderFlags struct {
+	mode    string
+	size    string
+	format  string
+	quality int
+	gravity string
+	enlarge bool
+	ops     string
+}
+
+// runRender обрабатывает локальный файл без сервера и кэша:
+// previewer render --in photo.jpg --out thumb.webp --size 300x200. Без --in
+// изображение читается из stdin, без --out результат пишется в stdout.
+func runRender(args []string) error {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	configPath := flags.String("config", "", "path to config file with source limits and output settings")
+	inPath := flags.String("in", "-", "input image, - for stdin")
+	outPath := flags.String("out", "-", "output file, - for stdout")
+
+	var rf renderFlags
+	flags.StringVar(&rf.mode, "mode", string(image.ImageActionFill), "fill or crop")
+	flags.StringVar(&rf.size, "size", "", "result size WIDTHxHEIGHT, 0 keeps the aspect ratio")
+	flags.StringVar(&rf.format, "format", "", "output format, by default taken from --out extension or the input")
+	flags.IntVar(&rf.quality, "quality", 0, "output quality, 0 for the format default")
+	flags.StringVar(&rf.gravity, "gravity", string(image.GravityCentre), "part of the image kept when cropping")
+	flags.BoolVar(&rf.enlarge, "enlarge", false, "allow upscaling the source")
+	flags.StringVar(&rf.ops, "ops", "", "processing steps, e.g. rot:90,bl:2")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var opts image.Options
+	if *configPath != "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		opts = renderOptions(cfg)
+
+		enlargeSet := false
+		flags.Visit(func(f *flag.Flag) { enlargeSet = enlargeSet || f.Name == "enlarge" })
+		if !enlargeSet {
+			rf.enlarge = cfg.Output.Enlarge
+		}
+	}
+
+	if rf.format == "" && *outPath != "-" {
+		rf.format = strings.TrimPrefix(filepath.Ext(*outPath), ".")
+	}
+
+	imgData, err := rf.imgData()
+	if err != nil {
+		return err
+	}
+
+	data, err := readInput(*inPath)
+	if err != nil {
+		return err
+	}
+
+	img, err := image.Load(data, 0)
+	if err != nil {
+		return err
+	}
+	defer img.VipsImg.Close()
+
+	if err := img.CheckLimits(opts.Limits); err != nil {
+		return err
+	}
+
+	result, err := img.Process(imgData, opts)
+	if err != nil {
+		return fmt.Errorf("failed to process image: %w", err)
+	}
+
+	if *outPath == "-" {
+		_, err = os.Stdout.Write(result)
+		return err
+	}
+
+	return os.WriteFile(*outPath, result, 0o644)
+}
+
+// renderOptions берёт из конфига те же лимиты и цветовой профиль, что
+// использует сервер. Водяные знаки и стили текста команде не нужны.
+func renderOptions(cfg *config.Config) image.Options {
+	return image.Options{
+		Limits:       app.ImageLimits(cfg),
+		Profile:      cfg.Output.ColorProfile,
+		EmbedProfile: cfg.Output.EmbedProfile,
+	}
+}
+
+// imgData переводит параметры команды в запрос к конвейеру обработки.
+func (rf renderFlags) imgData() (*image.ImgData, error) {
+	imgData := &image.ImgData{
+		Action:  image.Action(rf.mode),
+		Quality: rf.quality,
+		Enlarge: rf.enlarge,
+		DPR:     1,
+	}
+
+	switch imgData.Action {
+	case image.ImageActionFill:
+		width, height, err := parseSize(rf.size)
+		if err != nil {
+			return nil, err
+		}
+		imgData.Width, imgData.Height = width, height
+	case image.ImageActionCrop:
+		if rf.size != "" {
+			return nil, errors.New("--size is not supported in crop mode, use the crop step in --ops")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported mode %q, expected fill or crop", rf.mode)
+	}
+
+	gravity, err := image.ParseGravity(rf.gravity)
+	if err != nil {
+		return nil, err
+	}
+	imgData.Gravity = gravity
+
+	if rf.format != "" {
+		if imgData.Format, err = image.ParseFormat(rf.format); err != nil {
+			return nil, err
+		}
+	}
+
+	if rf.quality < 0 || rf.quality > 100 {
+		return nil, fmt.Errorf("quality must be from 0 to 100, got %d", rf.quality)
+	}
+
+	if rf.ops != "" {
+		if imgData.Steps, err = image.ParseSteps(rf.ops); err != nil {
+			return nil, err
+		}
+	}
+
+	return imgData, nil
+}
+
+// parseSize разбирает размер вида WIDTHxHEIGHT. Одна из сторон может быть
+// нулевой, тогда она вычисляется по пропорциям исходника.
+func parseSize(value string) (int, int, error) {
+	w, h, ok := strings.Cut(value, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid size %q, expected WIDTHxHEIGHT", value)
+	}
+
+	width, err := strconv.Atoi(w)
+	if err != nil || width < 0 {
+		return 0, 0, fmt.Errorf("invalid width in size %q", value)
+	}
+
+	height, err := strconv.Atoi(h)
+	if err != nil || height < 0 {
+		return 0, 0, fmt.Errorf("invalid height in size %q", value)
+	}
+
+	if width == 0 && height == 0 {
+		return 0, 0, fmt.Errorf("invalid size %q: width and height are both zero", value)
+	}
+
+	return width, height, nil
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		return data, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/IKolyas/thumbnailer/internal/core/image"
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderFlags(t *testing.T) {
+	t.Run("fill", func(t *testing.T) {
+		rf := renderFlags{mode: "fill", size: "300x0", format: "webp", quality: 75, gravity: "sm", ops: "rot:90,bl:2"}
+
+		imgData, err := rf.imgData()
+		require.NoError(t, err)
+		assert.Equal(t, image.ImageActionFill, imgData.Action)
+		assert.Equal(t, 300, imgData.Width)
+		assert.Equal(t, 0, imgData.Height)
+		assert.Equal(t, vips.ImageTypeWEBP, imgData.Format)
+		assert.Equal(t, 75, imgData.Quality)
+		assert.Equal(t, image.GravitySmart, imgData.Gravity)
+		require.Len(t, imgData.Steps, 2)
+		assert.Equal(t, "rotate:90", imgData.Steps[0].String())
+		assert.Equal(t, "blur:2", imgData.Steps[1].String())
+	})
+
+	t.Run("crop keeps source format", func(t *testing.T) {
+		rf := renderFlags{mode: "crop", gravity: "ce", ops: "gs"}
+
+		imgData, err := rf.imgData()
+		require.NoError(t, err)
+		assert.Equal(t, image.ImageActionCrop, imgData.Action)
+		assert.Equal(t, vips.ImageTypeUnknown, imgData.Format)
+		require.Len(t, imgData.Steps, 1)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, rf := range []renderFlags{
+			{mode: "fill", gravity: "ce"},
+			{mode: "fill", size: "0x0", gravity: "ce"},
+			{mode: "fill", size: "300", gravity: "ce"},
+			{mode: "fill", size: "-1x100", gravity: "ce"},
+			{mode: "fit", size: "300x200", gravity: "ce"},
+			{mode: "crop", size: "300x200", gravity: "ce"},
+			{mode: "fill", size: "300x200", gravity: "top"},
+			{mode: "fill", size: "300x200", gravity: "ce", format: "bmp"},
+			{mode: "fill", size: "300x200", gravity: "ce", quality: 101},
+			{mode: "fill", size: "300x200", gravity: "ce", ops: "unknown:1"},
+			{mode: "fill", size: "300x200", gravity: "ce", ops: "bl:2,rot:90"},
+		} {
+			_, err := rf.imgData()
+			assert.Error(t, err, rf)
+		}
+	})
+}
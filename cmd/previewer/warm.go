@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+
+	"github.com/IKolyas/thumbnailer/internal/app"
+	"github.com/IKolyas/thumbnailer/internal/config"
+)
+
+// runWarm прогревает кэш: previewer warm --config ... --list urls.txt. Без
+// --list список читается из stdin.
+func runWarm(args []string) error {
+	flags := flag.NewFlagSet("warm", flag.ContinueOnError)
+	configPath := flags.String("config", "./configs/config.json", "path to config file")
+	listPath := flags.String("list", "-", "file with source URLs and sizes, - for stdin")
+	concurrency := flags.Int("concurrency", runtime.GOMAXPROCS(0), "number of variants rendered in parallel")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var list io.Reader = os.Stdin
+	if *listPath != "-" {
+		file, err := os.Open(*listPath)
+		if err != nil {
+			return fmt.Errorf("failed to open list: %w", err)
+		}
+		defer file.Close()
+		list = file
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	application, err := app.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create app: %w", err)
+	}
+
+	return application.Warm(ctx, list, *concurrency, os.Stderr)
+}
@@ -1,14 +1,20 @@
 package app
 
 import (
+	"cmp"
 	"context"
+	"fmt"
 	"log"
+	"maps"
+	"slices"
 	"time"
 
 	"github.com/IKolyas/thumbnailer/internal/config"
+	"github.com/IKolyas/thumbnailer/internal/core/image"
 	"github.com/IKolyas/thumbnailer/internal/logger"
 	"github.com/IKolyas/thumbnailer/internal/server/http"
 	"github.com/IKolyas/thumbnailer/internal/storage/memory"
+	"github.com/IKolyas/thumbnailer/internal/storage/source"
 )
 
 type App struct {
@@ -24,22 +30,92 @@ func New(ctx context.Context, cfg *config.Config) (*App, error) {
 		log.Fatalf("failed to create logger: %v", err)
 	}
 
-	storage, err := memory.NewLRUStorage(cfg.CacheCapacity, cfg.StorageDir)
+	watermarks := make(map[string]*image.Watermark, len(cfg.Watermarks))
+	for name, wc := range cfg.Watermarks {
+		watermark, err := image.LoadWatermark(wc.Path, image.WatermarkParams{
+			Position: image.Position(wc.Gravity),
+			OffsetX:  wc.OffsetX,
+			OffsetY:  wc.OffsetY,
+			Opacity:  wc.Opacity,
+			Scale:    wc.Scale,
+			Tiled:    wc.Tiled,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid watermark %q: %w", name, err)
+		}
+		watermarks[name] = watermark
+	}
+
+	textStyles := make(map[string]image.TextStyle, len(cfg.TextStyles))
+	for name, tc := range cfg.TextStyles {
+		style, err := parseTextStyle(tc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid text style %q: %w", name, err)
+		}
+		textStyles[name] = style
+	}
+
+	sourceOptions := []source.Option{
+		source.WithMaxSize(cfg.Source.MaxSize),
+		source.WithLimits(ImageLimits(cfg)),
+		source.WithColorProfile(cfg.Output.ColorProfile, cfg.Output.EmbedProfile),
+		source.WithWatermarks(watermarks),
+		source.WithTextStyles(textStyles),
+	}
+
+	if len(cfg.Source.LocalRoots) > 0 {
+		local, err := source.NewLocal(cfg.Source.LocalRoots)
+		if err != nil {
+			return nil, err
+		}
+		sourceOptions = append(sourceOptions, source.WithBackend(source.LocalScheme, local))
+	}
+
+	origin := source.New(sourceOptions...)
+
+	storage, err := memory.NewLRUStorage(cfg.CacheCapacity, cfg.StorageDir, origin)
 	if err != nil {
 		log.Fatalf("Error create lru storage: %v", err)
 	}
 
+	if cfg.PersistCache {
+		if err := storage.Load(); err != nil {
+			return nil, fmt.Errorf("failed to load cache: %w", err)
+		}
+	}
+
 	timeout, err := time.ParseDuration(cfg.Timeout)
 	if err != nil {
 		log.Fatalf("Error parsing duration: %v", err)
 	}
 
+	presets := make(map[string]http.Preset, len(cfg.Output.Presets))
+	for name, value := range cfg.Output.Presets {
+		preset, err := http.ParsePreset(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preset %q: %w", name, err)
+		}
+		presets[name] = preset
+	}
+
 	server, err := http.NewServer(
 		cfg.Host,
 		storage,
 		logger,
 		http.WithMaxBodySize(cfg.MaxBodySize),
 		http.WithTimeout(timeout),
+		http.WithBatchConcurrency(cfg.BatchConcurrency),
+		http.WithOutputLimits(http.OutputLimits{
+			MinWidth:  cfg.Output.MinWidth,
+			MaxWidth:  cfg.Output.MaxWidth,
+			MinHeight: cfg.Output.MinHeight,
+			MaxHeight: cfg.Output.MaxHeight,
+		}),
+		http.WithPresets(presets, cfg.Output.PresetsOnly),
+		http.WithEnlarge(cfg.Output.Enlarge),
+		http.WithMaxDPR(cfg.Output.MaxDPR),
+		http.WithWatermarks(slices.Collect(maps.Keys(watermarks))),
+		http.WithTextStyles(slices.Collect(maps.Keys(textStyles))),
 	)
 	if err != nil {
 		return nil, err
@@ -53,6 +129,44 @@ func New(ctx context.Context, cfg *config.Config) (*App, error) {
 	}, nil
 }
 
+// ImageLimits возвращает лимиты обработки из конфига. Те же лимиты применяет
+// команда render.
+func ImageLimits(cfg *config.Config) image.Limits {
+	return image.Limits{
+		MaxPixels:  cfg.Source.MaxPixels,
+		MaxWidth:   cfg.Source.MaxWidth,
+		MaxHeight:  cfg.Source.MaxHeight,
+		MaxUpscale: cfg.Output.MaxUpscale,
+	}
+}
+
+func parseTextStyle(tc config.TextStyleConf) (image.TextStyle, error) {
+	position, err := image.ParsePosition(tc.Gravity)
+	if err != nil {
+		return image.TextStyle{}, err
+	}
+
+	style := image.TextStyle{
+		Font:     tc.Font,
+		Size:     tc.Size,
+		Padding:  tc.Padding,
+		Position: position,
+		OffsetX:  tc.OffsetX,
+		OffsetY:  tc.OffsetY,
+	}
+
+	if style.Color, err = image.ParseColor(cmp.Or(tc.Color, "ffffff")); err != nil {
+		return image.TextStyle{}, err
+	}
+	if tc.Background != "" {
+		if style.Background, err = image.ParseColor(tc.Background); err != nil {
+			return image.TextStyle{}, err
+		}
+	}
+
+	return style, nil
+}
+
 func (a *App) Run() error {
 	a.Logger.Info("Starting application")
 	return a.server.Start()
@@ -63,6 +177,9 @@ func (a *App) Stop() {
 		a.Logger.Error("Failed to stop server")
 	}
 	a.Logger.Info("Stop application")
+	if a.cfg.PersistCache {
+		return
+	}
 	if err := a.storage.Clear(); err != nil {
 		a.Logger.Error("Failed to clear cache")
 	}
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// sizeSpecRe - размер вида WIDTHxHEIGHT с необязательным форматом: 300x200,
+// 640x0.webp.
+var sizeSpecRe = regexp.MustCompile(`^(\d+)x(\d+)(?:\.(\w+))?$`)
+
+// parseWarmList читает список прогрева. Каждая строка - URL источника и один
+// или несколько вариантов через пробел. Вариант - размер WIDTHxHEIGHT[.format]
+// или имя пресета. Пустые строки и строки, начинающиеся с #, пропускаются.
+// Возвращает пути запросов к сервису: /resize для размеров и /preset для
+// пресетов, поэтому результаты попадают в кэш под теми же ключами, что и
+// обычные запросы. В режиме presetsOnly маршрут /resize отключён, поэтому
+// размеры в списке считаются ошибкой.
+func parseWarmList(list io.Reader, presetsOnly bool) ([]string, error) {
+	var paths []string
+
+	scanner := bufio.NewScanner(list)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("line %d: expected source URL and at least one size", line)
+		}
+
+		sourceURL := fields[0]
+		for _, spec := range fields[1:] {
+			if presetsOnly && sizeSpecRe.MatchString(spec) {
+				return nil, fmt.Errorf("line %d: size %s is not available with presetsOnly, use a preset name", line, spec)
+			}
+			paths = append(paths, warmPath(sourceURL, spec))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read list: %w", err)
+	}
+
+	return paths, nil
+}
+
+func warmPath(sourceURL, spec string) string {
+	matches := sizeSpecRe.FindStringSubmatch(spec)
+	if matches == nil {
+		return "/preset/" + spec + "/enc/" + base64.RawURLEncoding.EncodeToString([]byte(sourceURL))
+	}
+
+	query := url.Values{"url": {sourceURL}}
+	if matches[1] != "0" {
+		query.Set("w", matches[1])
+	}
+	if matches[2] != "0" {
+		query.Set("h", matches[2])
+	}
+	if matches[3] != "" {
+		query.Set("format", matches[3])
+	}
+
+	return "/resize?" + query.Encode()
+}
+
+// Warm обрабатывает варианты из списка так же, как запросы к сервису, и
+// сохраняет результаты в кэш. concurrency ограничивает число параллельных
+// запросов, ход прогрева пишется в progress. Возвращает ошибку, если хотя бы
+// один вариант не удалось обработать.
+func (a *App) Warm(ctx context.Context, list io.Reader, concurrency int, progress io.Writer) error {
+	if !a.cfg.PersistCache {
+		return errors.New("persistCache is disabled: the server would ignore the warmed cache and delete it on stop")
+	}
+
+	paths, err := parseWarmList(list, a.cfg.Output.PresetsOnly)
+	if err != nil {
+		return err
+	}
+
+	handler := a.server.Handler()
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		done      int
+		failed    atomic.Int32
+		semaphore = make(chan struct{}, max(concurrency, 1))
+	)
+
+	for _, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			status, size := warmRequest(ctx, handler, path)
+			if status != http.StatusOK {
+				failed.Add(1)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			fmt.Fprintf(progress, "[%d/%d] %d %s (%d bytes)\n", done, len(paths), status, path, size)
+		}()
+	}
+	wg.Wait()
+
+	fmt.Fprintf(progress, "warmed %d of %d variants\n", len(paths)-int(failed.Load()), len(paths))
+	if failed.Load() > 0 {
+		return fmt.Errorf("%d of %d variants failed", failed.Load(), len(paths))
+	}
+
+	return nil
+}
+
+// warmRequest выполняет запрос обработчиком сервиса и возвращает статус и
+// размер ответа.
+func warmRequest(ctx context.Context, handler http.Handler, path string) (int, int) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return http.StatusBadRequest, 0
+	}
+
+	w := &discardWriter{header: make(http.Header), status: http.StatusOK}
+	handler.ServeHTTP(w, req)
+
+	return w.status, w.size
+}
+
+// discardWriter - http.ResponseWriter, который запоминает статус и размер
+// ответа, не сохраняя тело.
+type discardWriter struct {
+	header http.Header
+	status int
+	size   int
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(data []byte) (int, error) {
+	w.size += len(data)
+	return len(data), nil
+}
+
+func (w *discardWriter) WriteHeader(status int) {
+	w.status = status
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWarmList(t *testing.T) {
+	t.Run("sizes and presets", func(t *testing.T) {
+		list := `
+# главная страница
+https://example.com/a.jpg 300x200 640x0.webp thumb
+
+https://example.com/b.png?v=2 0x150
+`
+
+		paths, err := parseWarmList(strings.NewReader(list), false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"/resize?h=200&url=https%3A%2F%2Fexample.com%2Fa.jpg&w=300",
+			"/resize?format=webp&url=https%3A%2F%2Fexample.com%2Fa.jpg&w=640",
+			"/preset/thumb/enc/aHR0cHM6Ly9leGFtcGxlLmNvbS9hLmpwZw",
+			"/resize?h=150&url=https%3A%2F%2Fexample.com%2Fb.png%3Fv%3D2",
+		}, paths)
+	})
+
+	t.Run("missing size", func(t *testing.T) {
+		_, err := parseWarmList(strings.NewReader("https://example.com/a.jpg\n"), false)
+		assert.Error(t, err)
+	})
+
+	t.Run("presets only", func(t *testing.T) {
+		paths, err := parseWarmList(strings.NewReader("https://example.com/a.jpg thumb\n"), true)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"/preset/thumb/enc/aHR0cHM6Ly9leGFtcGxlLmNvbS9hLmpwZw"}, paths)
+
+		_, err = parseWarmList(strings.NewReader("https://example.com/a.jpg thumb 300x200\n"), true)
+		assert.ErrorContains(t, err, "300x200")
+	})
+}
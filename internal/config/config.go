@@ -14,6 +14,64 @@ type Config struct {
 	MaxBodySize   int64      `json:"maxBodySize"`
 	Logger        LoggerConf `json:"logger"`
 	StorageDir    string     `json:"storageDir"`
+	Source        SourceConf `json:"source"`
+	Output        OutputConf `json:"output"`
+	// BatchConcurrency ограничивает число вариантов, обрабатываемых
+	// параллельно в /batch. Ноль означает число процессоров.
+	BatchConcurrency int `json:"batchConcurrency"`
+	// PersistCache сохраняет кэш между запусками: файлы в StorageDir не
+	// удаляются при остановке и загружаются при старте.
+	PersistCache bool `json:"persistCache"`
+	// Watermarks - водяные знаки, доступные в запросах по имени.
+	Watermarks map[string]WatermarkConf `json:"watermarks"`
+	// TextStyles - стили текста, доступные в запросах по имени.
+	TextStyles map[string]TextStyleConf `json:"textStyles"`
+}
+
+type SourceConf struct {
+	MaxSize   int64 `json:"maxSize"`
+	MaxPixels int   `json:"maxPixels"`
+	MaxWidth  int   `json:"maxWidth"`
+	MaxHeight int   `json:"maxHeight"`
+	// LocalRoots - каталоги локальных исходников по имени, доступные по
+	// URL вида file://{имя}/{путь}.
+	LocalRoots map[string]string `json:"localRoots"`
+}
+
+type OutputConf struct {
+	MinWidth    int               `json:"minWidth"`
+	MaxWidth    int               `json:"maxWidth"`
+	MinHeight   int               `json:"minHeight"`
+	MaxHeight   int               `json:"maxHeight"`
+	MaxUpscale  float64           `json:"maxUpscale"`
+	Enlarge     bool              `json:"enlarge"`
+	MaxDPR      float64           `json:"maxDpr"`
+	PresetsOnly bool              `json:"presetsOnly"`
+	Presets     map[string]string `json:"presets"`
+	// ColorProfile - путь к целевому ICC-профилю, пустой путь означает sRGB.
+	ColorProfile string `json:"colorProfile"`
+	EmbedProfile bool   `json:"embedProfile"`
+}
+
+type WatermarkConf struct {
+	Path    string  `json:"path"`
+	Gravity string  `json:"gravity"`
+	OffsetX int     `json:"offsetX"`
+	OffsetY int     `json:"offsetY"`
+	Opacity float64 `json:"opacity"`
+	Scale   float64 `json:"scale"`
+	Tiled   bool    `json:"tiled"`
+}
+
+type TextStyleConf struct {
+	Font       string `json:"font"`
+	Size       int    `json:"size"`
+	Color      string `json:"color"`
+	Background string `json:"background"`
+	Padding    int    `json:"padding"`
+	Gravity    string `json:"gravity"`
+	OffsetX    int    `json:"offsetX"`
+	OffsetY    int    `json:"offsetY"`
 }
 
 type LoggerConf struct {
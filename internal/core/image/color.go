@@ -0,0 +1,94 @@
+package image
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// cmykProfile - встроенный в libvips CMYK-профиль для изображений без
+// собственного профиля.
+const cmykProfile = "cmyk"
+
+// importProfile переводит изображение из встроенного ICC-профиля в целевой.
+// Изображения без профиля считаются sRGB и не конвертируются, кроме CMYK:
+// для них используется профиль libvips по умолчанию.
+func (i *Image) importProfile(target string) error {
+	cmyk := i.VipsImg.Interpretation() == vips.InterpretationCMYK
+	if !cmyk && !i.VipsImg.HasICCProfile() {
+		return nil
+	}
+
+	if target == "" {
+		target = vips.SRGBV2MicroICCProfilePath
+	}
+
+	fallback := vips.SRGBIEC6196621ICCProfilePath
+	if cmyk {
+		fallback = cmykProfile
+	}
+
+	// Целевой профиль прикрепляется к изображению и сохраняется при
+	// Options.EmbedProfile или keep=icc.
+	return i.VipsImg.TransformICCProfileWithFallback(target, fallback)
+}
+
+// ParseColor разбирает цвет вида RRGGBB или RRGGBBAA. Без альфа-канала цвет
+// непрозрачный.
+func ParseColor(value string) (vips.ColorRGBA, error) {
+	raw, err := hex.DecodeString(value)
+	if err != nil || (len(raw) != 3 && len(raw) != 4) {
+		return vips.ColorRGBA{}, fmt.Errorf("invalid color %q: expected RRGGBB or RRGGBBAA", value)
+	}
+
+	color := vips.ColorRGBA{R: raw[0], G: raw[1], B: raw[2], A: 255}
+	if len(raw) == 4 {
+		color.A = raw[3]
+	}
+	return color, nil
+}
+
+// formatColor возвращает цвет в формате ParseColor. Альфа-канал
+// указывается только для полупрозрачных цветов.
+func formatColor(color vips.ColorRGBA) string {
+	if color.A == 255 {
+		return hex.EncodeToString([]byte{color.R, color.G, color.B})
+	}
+	return hex.EncodeToString([]byte{color.R, color.G, color.B, color.A})
+}
+
+// solid создаёт sRGB-изображение width x height с альфа-каналом, залитое
+// цветом color.
+func solid(width, height int, color vips.ColorRGBA) (*vips.ImageRef, error) {
+	img, err := vips.Black(width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := paint(img, color); err != nil {
+		img.Close()
+		return nil, err
+	}
+
+	if err := img.BandJoinConst([]float64{float64(color.A)}); err != nil {
+		img.Close()
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// paint заменяет изображение sRGB-заливкой цветом color без альфа-канала.
+func paint(img *vips.ImageRef, color vips.ColorRGBA) error {
+	if err := img.ToColorSpace(vips.InterpretationSRGB); err != nil {
+		return err
+	}
+
+	rgb := []float64{float64(color.R), float64(color.G), float64(color.B)}
+	if err := img.Linear([]float64{0, 0, 0}, rgb); err != nil {
+		return err
+	}
+
+	return img.Cast(vips.BandFormatUchar)
+}
@@ -0,0 +1,84 @@
+package image
+
+import (
+	"os"
+	"testing"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCMYK(t *testing.T) {
+	// Левая половина без краски, правая - 100% cyan, профиль не встроен.
+	result := processFixture(t, "testdata/cmyk.jpg", Options{})
+
+	assert.Equal(t, vips.InterpretationSRGB, result.Interpretation())
+	assert.Equal(t, 3, result.Bands())
+	assert.False(t, result.HasICCProfile())
+
+	white, err := result.GetPoint(2, 8)
+	require.NoError(t, err)
+	for _, v := range white {
+		assert.Greater(t, v, 240.0)
+	}
+
+	cyan, err := result.GetPoint(13, 8)
+	require.NoError(t, err)
+	assert.Less(t, cyan[0], 80.0)
+	assert.Greater(t, cyan[2], 180.0)
+}
+
+func TestProcessDisplayP3(t *testing.T) {
+	// В Display P3 цвет (234, 51, 35) - это красный sRGB. Без конвертации
+	// значения остались бы прежними.
+	t.Run("convert to sRGB", func(t *testing.T) {
+		result := processFixture(t, "testdata/display-p3.png", Options{})
+		assert.False(t, result.HasICCProfile())
+
+		red, err := result.GetPoint(8, 8)
+		require.NoError(t, err)
+		assert.Greater(t, red[0], 250.0)
+		assert.Less(t, red[1], 15.0)
+		assert.Less(t, red[2], 15.0)
+	})
+
+	t.Run("embed profile", func(t *testing.T) {
+		result := processFixture(t, "testdata/display-p3.png", Options{EmbedProfile: true})
+		assert.True(t, result.HasICCProfile())
+	})
+}
+
+func processFixture(t *testing.T, path string, opts Options) *vips.ImageRef {
+	t.Helper()
+
+	source, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	img, err := NewImage(source)
+	require.NoError(t, err)
+
+	data, err := img.Process(&ImgData{Action: ImageActionCrop, Format: vips.ImageTypePNG}, opts)
+	require.NoError(t, err)
+
+	result, err := vips.NewImageFromBuffer(data)
+	require.NoError(t, err)
+	t.Cleanup(result.Close)
+
+	return result
+}
+
+func TestParseColor(t *testing.T) {
+	color, err := ParseColor("ff8000")
+	require.NoError(t, err)
+	assert.Equal(t, vips.ColorRGBA{R: 255, G: 128, B: 0, A: 255}, color)
+
+	color, err = ParseColor("00000080")
+	require.NoError(t, err)
+	assert.Equal(t, vips.ColorRGBA{A: 128}, color)
+
+	for _, value := range []string{"", "fff", "gggggg", "ff800000ff"} {
+		_, err := ParseColor(value)
+		assert.Error(t, err, value)
+	}
+}
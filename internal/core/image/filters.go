@@ -0,0 +1,191 @@
+package image
+
+import (
+	"errors"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Фильтры выполняются после ресайза: на уменьшенном изображении они
+// дешевле, а резкость после уменьшения компенсирует размытие от ресайза.
+
+// sepiaMatrix - матрица преобразования RGB в сепию.
+var sepiaMatrix = [][]float64{
+	{0.393, 0.769, 0.189},
+	{0.349, 0.686, 0.168},
+	{0.272, 0.534, 0.131},
+}
+
+type grayscaleOperation struct{}
+
+func parseGrayscale(args []string) (Operation, error) {
+	if len(args) != 0 {
+		return nil, errors.New("expected no arguments")
+	}
+	return grayscaleOperation{}, nil
+}
+
+func (grayscaleOperation) Apply(img *vips.ImageRef) error {
+	return img.ToColorSpace(vips.InterpretationBW)
+}
+
+func (grayscaleOperation) Stage() Stage {
+	return StageAfterResize
+}
+
+func (grayscaleOperation) String() string {
+	return "grayscale"
+}
+
+type sepiaOperation struct{}
+
+func parseSepia(args []string) (Operation, error) {
+	if len(args) != 0 {
+		return nil, errors.New("expected no arguments")
+	}
+	return sepiaOperation{}, nil
+}
+
+func (sepiaOperation) Apply(img *vips.ImageRef) error {
+	if err := img.ToColorSpace(vips.InterpretationSRGB); err != nil {
+		return err
+	}
+	if err := img.Recomb(sepiaMatrix); err != nil {
+		return err
+	}
+	// Recomb возвращает float, значения выше 255 обрезаются при приведении.
+	return img.Cast(vips.BandFormatUchar)
+}
+
+func (sepiaOperation) Stage() Stage {
+	return StageAfterResize
+}
+
+func (sepiaOperation) String() string {
+	return "sepia"
+}
+
+// brightnessOperation прибавляет value к каждому цветовому каналу.
+type brightnessOperation struct {
+	value float64
+}
+
+func parseBrightness(args []string) (Operation, error) {
+	value, err := floatArg(args, -255, 255)
+	if err != nil {
+		return nil, err
+	}
+	return &brightnessOperation{value: value}, nil
+}
+
+func (op *brightnessOperation) Apply(img *vips.ImageRef) error {
+	return linearColor(img, 1, op.value)
+}
+
+func (op *brightnessOperation) Stage() Stage {
+	return StageAfterResize
+}
+
+func (op *brightnessOperation) String() string {
+	return "brightness:" + formatFloat(op.value)
+}
+
+// contrastOperation растягивает значения относительно середины диапазона.
+// Значение 1 оставляет изображение без изменений.
+type contrastOperation struct {
+	value float64
+}
+
+func parseContrast(args []string) (Operation, error) {
+	value, err := floatArg(args, 0, 3)
+	if err != nil {
+		return nil, err
+	}
+	return &contrastOperation{value: value}, nil
+}
+
+func (op *contrastOperation) Apply(img *vips.ImageRef) error {
+	return linearColor(img, op.value, 128*(1-op.value))
+}
+
+func (op *contrastOperation) Stage() Stage {
+	return StageAfterResize
+}
+
+func (op *contrastOperation) String() string {
+	return "contrast:" + formatFloat(op.value)
+}
+
+// saturationOperation умножает насыщенность. Значение 1 оставляет
+// изображение без изменений, 0 делает его серым.
+type saturationOperation struct {
+	value float64
+}
+
+func parseSaturation(args []string) (Operation, error) {
+	value, err := floatArg(args, 0, 3)
+	if err != nil {
+		return nil, err
+	}
+	return &saturationOperation{value: value}, nil
+}
+
+func (op *saturationOperation) Apply(img *vips.ImageRef) error {
+	format := img.BandFormat()
+	if err := img.Modulate(1, op.value, 0); err != nil {
+		return err
+	}
+	return img.Cast(format)
+}
+
+func (op *saturationOperation) Stage() Stage {
+	return StageAfterResize
+}
+
+func (op *saturationOperation) String() string {
+	return "saturation:" + formatFloat(op.value)
+}
+
+type gammaOperation struct {
+	value float64
+}
+
+func parseGamma(args []string) (Operation, error) {
+	value, err := floatArg(args, 0.1, 10)
+	if err != nil {
+		return nil, err
+	}
+	return &gammaOperation{value: value}, nil
+}
+
+func (op *gammaOperation) Apply(img *vips.ImageRef) error {
+	return img.Gamma(op.value)
+}
+
+func (op *gammaOperation) Stage() Stage {
+	return StageAfterResize
+}
+
+func (op *gammaOperation) String() string {
+	return "gamma:" + formatFloat(op.value)
+}
+
+// linearColor вычисляет a*x + b для цветовых каналов, не трогая альфа-канал,
+// и возвращает исходный формат пикселей.
+func linearColor(img *vips.ImageRef, a, b float64) error {
+	format := img.BandFormat()
+
+	bands := img.Bands()
+	as, bs := make([]float64, bands), make([]float64, bands)
+	for band := range bands {
+		as[band], bs[band] = a, b
+	}
+	if img.HasAlpha() {
+		as[bands-1], bs[bands-1] = 1, 0
+	}
+
+	if err := img.Linear(as, bs); err != nil {
+		return err
+	}
+	return img.Cast(format)
+}
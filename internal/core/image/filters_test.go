@@ -0,0 +1,57 @@
+package image
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessFilters(t *testing.T) {
+	process := func(t *testing.T, steps ...string) []float64 {
+		t.Helper()
+
+		ops := make([]Operation, 0, len(steps))
+		for _, step := range steps {
+			parts := strings.Split(step, ":")
+			op, err := ParseOperation(parts[0], parts[1:])
+			require.NoError(t, err)
+			ops = append(ops, op)
+		}
+
+		img, err := NewImage(testJPEG(t, 64, 64))
+		require.NoError(t, err)
+
+		data, err := img.Process(&ImgData{Action: ImageActionCrop, Format: vips.ImageTypePNG, Steps: ops}, Options{})
+		require.NoError(t, err)
+
+		result, err := vips.NewImageFromBuffer(data)
+		require.NoError(t, err)
+		defer result.Close()
+
+		pixel, err := result.GetPoint(32, 32)
+		require.NoError(t, err)
+		return pixel
+	}
+
+	t.Run("brightness", func(t *testing.T) {
+		assert.Equal(t, []float64{50}, process(t, "br:50"))
+	})
+
+	t.Run("contrast around middle gray", func(t *testing.T) {
+		assert.Equal(t, []float64{128}, process(t, "br:128", "co:2"))
+	})
+
+	t.Run("sepia", func(t *testing.T) {
+		pixel := process(t, "br:100", "sepia")
+		require.Len(t, pixel, 3)
+		assert.Greater(t, pixel[0], pixel[1])
+		assert.Greater(t, pixel[1], pixel[2])
+	})
+
+	t.Run("grayscale", func(t *testing.T) {
+		assert.Len(t, process(t, "br:100", "sepia", "gs"), 1)
+	})
+}
@@ -1,8 +1,19 @@
 package image
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	stdimage "image"
+	// Форматы для чтения заголовков в Size.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/davidbyttow/govips/v2/vips"
 )
@@ -11,54 +22,334 @@ type Action string
 
 const (
 	ImageActionFill Action = "fill"
+	// ImageActionCrop выполняет только шаги конвейера, без ресайза.
+	ImageActionCrop Action = "crop"
+	// ImageActionBlurHash и ImageActionLQIP возвращают текстовые
+	// плейсхолдеры вместо изображения, см. Image.BlurHash и Image.LQIP.
+	ImageActionBlurHash Action = "blurhash"
+	ImageActionLQIP     Action = "lqip"
+	// ImageActionInfo возвращает сведения об исходнике в JSON, см. Image.Info.
+	ImageActionInfo Action = "info"
 )
 
-type Interface interface {
-	Resize(width, height int) error
-	Thumbnail(width, height int) error
-	Export(format vips.ImageType) ([]byte, error)
-	Fill()
-	Convert()
+// Gravity задаёт, какая часть изображения сохраняется при обрезке.
+type Gravity string
+
+const (
+	GravityCentre Gravity = "ce"
+	GravitySmart  Gravity = "sm"
+	// GravityFocalPoint сохраняет в кадре точку ImgData.FocalPoint.
+	GravityFocalPoint Gravity = "fp"
+)
+
+// FocalPoint - точка интереса в нормализованных координатах от 0 до 1.
+type FocalPoint struct {
+	X float64
+	Y float64
+}
+
+// ParseFocalPoint проверяет нормализованные координаты точки интереса.
+func ParseFocalPoint(x, y string) (FocalPoint, error) {
+	fx, errX := strconv.ParseFloat(x, 64)
+	fy, errY := strconv.ParseFloat(y, 64)
+	if errX != nil || errY != nil || math.IsNaN(fx) || math.IsNaN(fy) || fx < 0 || fx > 1 || fy < 0 || fy > 1 {
+		return FocalPoint{}, fmt.Errorf("invalid focal point %s,%s: coordinates must be between 0 and 1", x, y)
+	}
+	return FocalPoint{X: fx, Y: fy}, nil
+}
+
+func (fp FocalPoint) String() string {
+	return formatFloat(fp.X) + ":" + formatFloat(fp.Y)
+}
+
+var gravities = map[string]Gravity{
+	"ce":     GravityCentre,
+	"centre": GravityCentre,
+	"center": GravityCentre,
+	"sm":     GravitySmart,
+	"smart":  GravitySmart,
+}
+
+// ParseGravity возвращает gravity по полному или короткому имени.
+func ParseGravity(name string) (Gravity, error) {
+	gravity, ok := gravities[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("unsupported gravity: %q", name)
+	}
+	return gravity, nil
+}
+
+func (g Gravity) interesting() vips.Interesting {
+	if g == GravitySmart {
+		return vips.InterestingAttention
+	}
+	return vips.InterestingCentre
+}
+
+var (
+	// ErrLimitExceeded возвращается, если исходное изображение превышает лимиты.
+	ErrLimitExceeded = errors.New("image exceeds limits")
+	// ErrOutOfBounds возвращается, если параметры операции выходят за границы изображения.
+	ErrOutOfBounds = errors.New("out of image bounds")
+	// ErrUnsupported возвращается, если операция неприменима к изображению.
+	ErrUnsupported = errors.New("unsupported operation")
+)
+
+// Limits ограничивает размеры исходного изображения и коэффициент его
+// увеличения. Нулевое значение означает отсутствие ограничения.
+type Limits struct {
+	MaxPixels  int
+	MaxWidth   int
+	MaxHeight  int
+	MaxUpscale float64
+}
+
+// Options - настройки обработки, общие для всех запросов.
+type Options struct {
+	Limits Limits
+	// Profile - путь к целевому ICC-профилю. По умолчанию используется
+	// компактный sRGB.
+	Profile string
+	// EmbedProfile встраивает целевой профиль в результат.
+	EmbedProfile bool
+	// Watermarks - реестр водяных знаков по имени.
+	Watermarks map[string]*Watermark
+	// TextStyles - реестр стилей текста по имени.
+	TextStyles map[string]TextStyle
+}
+
+// formats - форматы, которые можно запросить для результата.
+var formats = map[string]vips.ImageType{
+	"jpeg": vips.ImageTypeJPEG,
+	"jpg":  vips.ImageTypeJPEG,
+	"png":  vips.ImageTypePNG,
+	"webp": vips.ImageTypeWEBP,
+	"gif":  vips.ImageTypeGIF,
+	"tiff": vips.ImageTypeTIFF,
+	"avif": vips.ImageTypeAVIF,
+}
+
+var contentTypes = map[vips.ImageType]string{
+	vips.ImageTypeJPEG: "image/jpeg",
+	vips.ImageTypePNG:  "image/png",
+	vips.ImageTypeWEBP: "image/webp",
+	vips.ImageTypeGIF:  "image/gif",
+	vips.ImageTypeTIFF: "image/tiff",
+	vips.ImageTypeAVIF: "image/avif",
+	vips.ImageTypeHEIF: "image/heif",
+	vips.ImageTypeBMP:  "image/bmp",
+	vips.ImageTypeJP2K: "image/jp2",
+	vips.ImageTypeJXL:  "image/jxl",
+}
+
+// ParseFormat возвращает формат результата по его имени.
+func ParseFormat(name string) (vips.ImageType, error) {
+	format, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return vips.ImageTypeUnknown, fmt.Errorf("unsupported output format: %q", name)
+	}
+	return format, nil
+}
+
+// ContentType определяет MIME-тип закодированного изображения.
+func ContentType(imgData []byte) string {
+	if contentType, ok := contentTypes[vips.DetermineImageType(imgData)]; ok {
+		return contentType
+	}
+	return "application/octet-stream"
 }
 
 type ImgData struct {
-	ImageURL string
-	Width    int
-	Height   int
-	Format   vips.ImageType
-	Action   Action
+	ImageURL   string
+	Width      int
+	Height     int
+	Format     vips.ImageType
+	Action     Action
+	Gravity    Gravity
+	FocalPoint FocalPoint
+	Enlarge    bool
+	DPR        float64
+	Quality    int
+	Steps      []Operation
+	// Frame - номер кадра анимации начиная с 1. Нулевое значение сохраняет
+	// все кадры.
+	Frame int
+	// Watermark - имя водяного знака из реестра Options.Watermarks.
+	Watermark string
+	// Text - текст в кодировке UTF-8, TextStyle - имя стиля из реестра
+	// Options.TextStyles.
+	Text      string
+	TextStyle string
+	// Метаданные удаляются из результата. KeepICC и KeepCopyright
+	// сохраняют ICC-профиль и поля об авторских правах.
+	KeepICC       bool
+	KeepCopyright bool
+	// Colors - число цветов палитры для ImageActionInfo.
+	Colors int
 }
 
 func (img *ImgData) String() string {
+	gravity := string(img.Gravity)
+	if img.Gravity == GravityFocalPoint {
+		gravity += ":" + img.FocalPoint.String()
+	}
+
 	hash := sha256.New()
-	hash.Write(fmt.Appendf(nil, "%s|%d|%d|%v|%s", img.ImageURL, img.Width, img.Height, img.Format, img.Action))
+	hash.Write(fmt.Appendf(nil, "%s|%d|%d|%v|%s|%s|%t|%g|%d|%s|%d|%s|%q|%s|%t|%t|%d",
+		img.ImageURL, img.Width, img.Height, img.Format, img.Action, gravity, img.Enlarge, img.DPR, img.Quality,
+		stepsKey(img.Steps), img.Frame, img.Watermark, img.Text, img.TextStyle, img.KeepICC, img.KeepCopyright,
+		img.Colors))
 	return fmt.Sprintf("%x", hash.Sum(nil))
 }
 
 type Image struct {
 	VipsImg *vips.ImageRef
-	Interface
 }
 
+// animatedFormats - форматы, поддерживающие анимацию.
+var animatedFormats = map[vips.ImageType]bool{
+	vips.ImageTypeGIF:  true,
+	vips.ImageTypeWEBP: true,
+}
+
+// NewImage загружает изображение со всеми кадрами анимации.
 func NewImage(imgData []byte) (*Image, error) {
+	return Load(imgData, 0)
+}
+
+// Load загружает изображение. frame - номер кадра анимации начиная с 1,
+// нулевое значение загружает все кадры. Кадры анимации располагаются
+// друг под другом, высота одного кадра - PageHeight.
+func Load(imgData []byte, frame int) (*Image, error) {
 	img, err := vips.NewImageFromBuffer(imgData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load image: %w", err)
 	}
 
+	pages := img.Pages()
+	if frame > pages {
+		img.Close()
+		return nil, fmt.Errorf("%w: frame %d is greater than %d", ErrOutOfBounds, frame, pages)
+	}
+
+	// По умолчанию libvips загружает только первый кадр.
+	if !animatedFormats[img.Format()] || frame == 1 || (frame == 0 && pages == 1) {
+		return &Image{VipsImg: img}, nil
+	}
+	img.Close()
+
+	params := vips.NewImportParams()
+	if frame > 0 {
+		params.Page.Set(frame - 1)
+	} else {
+		params.NumPages.Set(-1)
+	}
+
+	img, err = vips.LoadImageFromBuffer(imgData, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load image: %w", err)
+	}
+
 	return &Image{VipsImg: img}, nil
 }
 
-func (i *Image) Fill(imgData *ImgData) ([]byte, error) {
-	if err := i.resize(imgData.Width, imgData.Height); err != nil {
-		return nil, fmt.Errorf("failed to resize image: %w", err)
+// CheckLimits проверяет размеры изображения по заголовку. libvips декодирует
+// пиксели лениво, поэтому проверка выполняется до распаковки изображения.
+func (i *Image) CheckLimits(limits Limits) error {
+	width, height := i.VipsImg.Width(), i.VipsImg.PageHeight()
+	// Лимит пикселей учитывает все кадры анимации.
+	pixels := width * i.VipsImg.Height()
+
+	if limits.MaxWidth > 0 && width > limits.MaxWidth {
+		return fmt.Errorf("%w: width %d is greater than %d", ErrLimitExceeded, width, limits.MaxWidth)
+	}
+
+	if limits.MaxHeight > 0 && height > limits.MaxHeight {
+		return fmt.Errorf("%w: height %d is greater than %d", ErrLimitExceeded, height, limits.MaxHeight)
+	}
+
+	if limits.MaxPixels > 0 && pixels > limits.MaxPixels {
+		return fmt.Errorf("%w: %d pixels is greater than %d", ErrLimitExceeded, pixels, limits.MaxPixels)
+	}
+
+	return nil
+}
+
+// Size возвращает размеры закодированного изображения, читая только заголовок.
+// Размеры нужны для каждого ответа, в том числе из кэша, поэтому JPEG, PNG и
+// GIF разбираются без libvips: загрузчик GIF в libvips при чтении заголовка
+// просматривает все кадры. Остальные форматы libvips загружает лениво, и
+// пиксели не декодируются.
+func Size(imgData []byte) (int, int, error) {
+	switch vips.DetermineImageType(imgData) {
+	case vips.ImageTypeJPEG, vips.ImageTypePNG, vips.ImageTypeGIF:
+		config, _, err := stdimage.DecodeConfig(bytes.NewReader(imgData))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read image header: %w", err)
+		}
+		return config.Width, config.Height, nil
+	}
+
+	img, err := vips.NewImageFromBuffer(imgData)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load image: %w", err)
+	}
+	defer img.Close()
+
+	return img.Width(), img.Height(), nil
+}
+
+// Process выполняет конвейер обработки: шаги до ресайза, ресайз согласно
+// imgData.Action, шаги после ресайза, текст, водяной знак и однократное
+// кодирование результата.
+func (i *Image) Process(imgData *ImgData, opts Options) ([]byte, error) {
+	// Телефоны сохраняют снимки как есть и указывают поворот в EXIF, поэтому
+	// ориентация применяется до любых операций.
+	if err := i.VipsImg.AutoRotate(); err != nil {
+		return nil, fmt.Errorf("failed to auto-rotate image: %w", err)
+	}
+
+	if err := i.importProfile(opts.Profile); err != nil {
+		return nil, fmt.Errorf("failed to convert colour profile: %w", err)
+	}
+
+	before, after, err := splitSteps(imgData.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := i.apply(before); err != nil {
+		return nil, err
+	}
+
+	switch imgData.Action {
+	case ImageActionFill:
+		if err := i.fill(imgData, opts.Limits); err != nil {
+			return nil, err
+		}
+	case ImageActionCrop:
+	default:
+		return nil, fmt.Errorf("unsupported action: %q", imgData.Action)
+	}
+
+	if err := i.apply(after); err != nil {
+		return nil, err
+	}
+
+	if err := i.text(imgData.Text, imgData.TextStyle, opts.TextStyles); err != nil {
+		return nil, err
 	}
 
-	if err := i.thumbnail(imgData.Width, imgData.Height); err != nil {
-		return nil, fmt.Errorf("failed to thumbnail image: %w", err)
+	if err := i.watermark(imgData.Watermark, opts.Watermarks); err != nil {
+		return nil, err
 	}
 
-	result, err := i.export()
+	keepICC := imgData.KeepICC || opts.EmbedProfile
+	if err := i.stripMetadata(keepICC, imgData.KeepCopyright); err != nil {
+		return nil, fmt.Errorf("failed to strip metadata: %w", err)
+	}
+
+	result, err := i.export(imgData.Format, imgData.Quality)
 	if err != nil {
 		return nil, fmt.Errorf("failed to export image: %w", err)
 	}
@@ -66,8 +357,43 @@ func (i *Image) Fill(imgData *ImgData) ([]byte, error) {
 	return result, nil
 }
 
+func (i *Image) fill(imgData *ImgData, limits Limits) error {
+	// Без разрешения на увеличение изображение не растягивается больше исходного.
+	maxScale := limits.MaxUpscale
+	if !imgData.Enlarge {
+		maxScale = 1
+	}
+
+	srcWidth, srcHeight := i.VipsImg.Width(), i.VipsImg.PageHeight()
+	width, height := targetSize(srcWidth, srcHeight, imgData.Width, imgData.Height)
+	width, height = limitSize(srcWidth, srcHeight, width, height, maxScale)
+
+	// Thumbnail не различает кадры анимации, поэтому все кадры обрезаются
+	// одинаково относительно центра.
+	if imgData.Gravity == GravityFocalPoint || i.animated() {
+		fp := imgData.FocalPoint
+		if imgData.Gravity != GravityFocalPoint {
+			fp = FocalPoint{X: 0.5, Y: 0.5}
+		}
+		if err := i.focalCrop(width, height, fp); err != nil {
+			return fmt.Errorf("failed to crop image to focal point: %w", err)
+		}
+		return nil
+	}
+
+	if err := i.resize(width, height); err != nil {
+		return fmt.Errorf("failed to resize image: %w", err)
+	}
+
+	if err := i.thumbnail(width, height, imgData.Gravity); err != nil {
+		return fmt.Errorf("failed to thumbnail image: %w", err)
+	}
+
+	return nil
+}
+
 func (i *Image) resize(width, height int) error {
-	scale := calculateScale(i.VipsImg, width, height)
+	scale := calculateScale(i.VipsImg.Width(), i.VipsImg.Height(), width, height)
 	err := i.VipsImg.Resize(scale, vips.KernelLanczos3)
 	if err != nil {
 		return fmt.Errorf("failed to resize image: %w", err)
@@ -75,9 +401,9 @@ func (i *Image) resize(width, height int) error {
 	return nil
 }
 
-func (i *Image) thumbnail(width, height int) error {
+func (i *Image) thumbnail(width, height int, gravity Gravity) error {
 	if width > 0 && height > 0 {
-		err := i.VipsImg.Thumbnail(width, height, vips.InterestingCentre)
+		err := i.VipsImg.Thumbnail(width, height, gravity.interesting())
 		if err != nil {
 			return fmt.Errorf("failed to thumbnail image: %w", err)
 		}
@@ -85,13 +411,91 @@ func (i *Image) thumbnail(width, height int) error {
 	return nil
 }
 
-func (i *Image) export() ([]byte, error) {
-	format := i.VipsImg.Metadata().Format
+// animationFields - поля, из которых кодировщики берут задержки кадров и
+// число повторов анимации.
+var animationFields = []string{"delay", "loop"}
+
+// copyrightFields - поля EXIF, сохраняемые при KeepCopyright. Блок exif-data
+// остаётся, но при сохранении libvips удаляет из него теги без
+// соответствующих полей, в том числе GPS.
+var copyrightFields = []string{
+	"exif-data",
+	"exif-ifd0-Copyright",
+	"exif-ifd0-Artist",
+}
+
+// stripMetadata удаляет EXIF, XMP, IPTC и GPS.
+func (i *Image) stripMetadata(keepICC, keepCopyright bool) error {
+	keep := animationFields
+	if keepCopyright {
+		keep = slices.Concat(animationFields, copyrightFields)
+	}
+
+	if err := i.VipsImg.RemoveMetadata(keep...); err != nil {
+		return err
+	}
+
+	// RemoveMetadata не трогает ICC-профиль, он удаляется отдельно.
+	if !keepICC && i.VipsImg.HasICCProfile() {
+		return i.VipsImg.RemoveICCProfile()
+	}
+
+	return nil
+}
+
+// focalCrop масштабирует изображение так, чтобы оно покрыло целевую область,
+// и вырезает область, центр которой максимально близок к точке интереса.
+func (i *Image) focalCrop(width, height int, fp FocalPoint) error {
+	pageHeight := i.VipsImg.PageHeight()
+	scale := max(float64(width)/float64(i.VipsImg.Width()), float64(height)/float64(pageHeight))
+
+	// Вертикальный масштаб подбирается так, чтобы высота кадра стала целой и
+	// кадры анимации не смещались относительно друг друга.
+	vscale := math.Round(float64(pageHeight)*scale) / float64(pageHeight)
+	if err := i.VipsImg.ResizeWithVScale(scale, vscale, vips.KernelLanczos3); err != nil {
+		return fmt.Errorf("failed to resize image: %w", err)
+	}
+
+	// После масштабирования сторона может оказаться на пиксель меньше из-за округления.
+	imgWidth, imgHeight := i.VipsImg.Width(), i.VipsImg.PageHeight()
+	width, height = min(width, imgWidth), min(height, imgHeight)
+
+	return i.VipsImg.ExtractArea(
+		focalOffset(imgWidth, width, fp.X),
+		focalOffset(imgHeight, height, fp.Y),
+		width,
+		height,
+	)
+}
+
+// animated сообщает, загружено ли несколько кадров анимации.
+func (i *Image) animated() bool {
+	return i.VipsImg.Height() > i.VipsImg.PageHeight()
+}
+
+// firstFrame оставляет первый кадр для форматов без поддержки анимации.
+func (i *Image) firstFrame() error {
+	if err := i.VipsImg.Crop(0, 0, i.VipsImg.Width(), i.VipsImg.PageHeight()); err != nil {
+		return err
+	}
+	return i.VipsImg.SetPages(1)
+}
+
+func (i *Image) export(format vips.ImageType, quality int) ([]byte, error) {
+	if format == vips.ImageTypeUnknown {
+		format = i.VipsImg.Metadata().Format
+	}
+
+	if i.animated() && !animatedFormats[format] {
+		if err := i.firstFrame(); err != nil {
+			return nil, fmt.Errorf("failed to extract first frame: %w", err)
+		}
+	}
 
 	switch format {
 	case vips.ImageTypeJPEG:
 		params := vips.NewJpegExportParams()
-		params.Quality = 85
+		params.Quality = qualityOrDefault(quality, 85)
 		params.OptimizeCoding = true
 		imageBytes, _, err := i.VipsImg.ExportJpeg(params)
 		if err != nil {
@@ -111,7 +515,7 @@ func (i *Image) export() ([]byte, error) {
 
 	case vips.ImageTypeWEBP:
 		params := vips.NewWebpExportParams()
-		params.Quality = 80
+		params.Quality = qualityOrDefault(quality, 80)
 		params.Lossless = false
 		params.ReductionEffort = 4
 		imageBytes, _, err := i.VipsImg.ExportWebp(params)
@@ -120,7 +524,34 @@ func (i *Image) export() ([]byte, error) {
 		}
 		return imageBytes, nil
 
-	case vips.ImageTypeGIF, vips.ImageTypeTIFF, vips.ImageTypeBMP:
+	case vips.ImageTypeGIF:
+		params := vips.NewGifExportParams()
+		params.Quality = qualityOrDefault(quality, params.Quality)
+		imageBytes, _, err := i.VipsImg.ExportGIF(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export GIF: %w", err)
+		}
+		return imageBytes, nil
+
+	case vips.ImageTypeTIFF:
+		params := vips.NewTiffExportParams()
+		params.Quality = qualityOrDefault(quality, params.Quality)
+		imageBytes, _, err := i.VipsImg.ExportTiff(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export TIFF: %w", err)
+		}
+		return imageBytes, nil
+
+	case vips.ImageTypeAVIF:
+		params := vips.NewAvifExportParams()
+		params.Quality = qualityOrDefault(quality, params.Quality)
+		imageBytes, _, err := i.VipsImg.ExportAvif(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export AVIF: %w", err)
+		}
+		return imageBytes, nil
+
+	case vips.ImageTypeBMP:
 		// Для этих форматов используем стандартный экспорт
 		imageBytes, _, err := i.VipsImg.ExportNative()
 		if err != nil {
@@ -128,7 +559,7 @@ func (i *Image) export() ([]byte, error) {
 		}
 		return imageBytes, nil
 
-	case vips.ImageTypeAVIF, vips.ImageTypeHEIF, vips.ImageTypeJP2K, vips.ImageTypeJXL:
+	case vips.ImageTypeHEIF, vips.ImageTypeJP2K, vips.ImageTypeJXL:
 		// Современные форматы с настройками по умолчанию
 		imageBytes, _, err := i.VipsImg.ExportNative()
 		if err != nil {
@@ -149,22 +580,70 @@ func (i *Image) export() ([]byte, error) {
 	}
 }
 
-// вычисляет коэффициент масштабирования с сохранением пропорций.
-func calculateScale(img *vips.ImageRef, width, height int) float64 {
-	if width == 0 && height == 0 {
-		return 1.0
+func qualityOrDefault(quality, defaultQuality int) int {
+	if quality > 0 {
+		return quality
 	}
+	return defaultQuality
+}
 
+// вычисляет коэффициент масштабирования с сохранением пропорций.
+func calculateScale(srcWidth, srcHeight, width, height int) float64 {
 	switch {
 	case width == 0 && height == 0:
 		return 1.0
 	case width > 0 && height > 0:
-		scaleW := float64(width) / float64(img.Width())
-		scaleH := float64(height) / float64(img.Height())
+		scaleW := float64(width) / float64(srcWidth)
+		scaleH := float64(height) / float64(srcHeight)
 		return min(scaleW, scaleH)
 	case width > 0:
-		return float64(width) / float64(img.Width())
+		return float64(width) / float64(srcWidth)
+	default:
+		return float64(height) / float64(srcHeight)
+	}
+}
+
+// вычисляет размер результата. Нулевая сторона считается автоматической и
+// вычисляется по пропорциям исходника.
+func targetSize(srcWidth, srcHeight, width, height int) (int, int) {
+	switch {
+	case width == 0 && height == 0:
+		return srcWidth, srcHeight
+	case width == 0:
+		return scaleSide(srcWidth, float64(height)/float64(srcHeight)), height
+	case height == 0:
+		return width, scaleSide(srcHeight, float64(width)/float64(srcWidth))
 	default:
-		return float64(height) / float64(img.Height())
+		return width, height
+	}
+}
+
+// уменьшает целевой размер так, чтобы изображение не увеличивалось
+// больше чем в maxScale раз. Пропорции целевой области сохраняются.
+func limitSize(srcWidth, srcHeight, width, height int, maxScale float64) (int, int) {
+	if maxScale <= 0 || srcWidth == 0 || srcHeight == 0 {
+		return width, height
+	}
+
+	scale := max(float64(width)/float64(srcWidth), float64(height)/float64(srcHeight))
+	if scale <= maxScale {
+		return width, height
+	}
+
+	ratio := maxScale / scale
+	return scaleSide(width, ratio), scaleSide(height, ratio)
+}
+
+func scaleSide(side int, ratio float64) int {
+	if side == 0 {
+		return 0
 	}
+	return max(1, int(math.Round(float64(side)*ratio)))
+}
+
+// вычисляет смещение области размера crop внутри стороны size так, чтобы
+// точка focus оказалась как можно ближе к центру области.
+func focalOffset(size, crop int, focus float64) int {
+	offset := int(math.Round(focus*float64(size) - float64(crop)/2))
+	return max(0, min(offset, size-crop))
 }
@@ -0,0 +1,229 @@
+package image
+
+import (
+	"os"
+	"testing"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	vips.Startup(nil)
+	code := m.Run()
+	vips.Shutdown()
+	os.Exit(code)
+}
+
+func TestCalculateScale(t *testing.T) {
+	assert.Equal(t, 1.0, calculateScale(800, 600, 0, 0))
+	assert.Equal(t, 0.5, calculateScale(800, 600, 400, 0))
+	assert.Equal(t, 0.5, calculateScale(800, 600, 0, 300))
+	assert.Equal(t, 0.25, calculateScale(800, 600, 200, 300))
+	assert.Equal(t, 2.0, calculateScale(800, 600, 1600, 0))
+}
+
+func TestTargetSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		wantW, wantH  int
+	}{
+		{name: "both set", width: 300, height: 300, wantW: 300, wantH: 300},
+		{name: "auto width", width: 0, height: 300, wantW: 400, wantH: 300},
+		{name: "auto height", width: 400, height: 0, wantW: 400, wantH: 300},
+		{name: "both auto", width: 0, height: 0, wantW: 800, wantH: 600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h := targetSize(800, 600, tt.width, tt.height)
+			assert.Equal(t, tt.wantW, w)
+			assert.Equal(t, tt.wantH, h)
+		})
+	}
+}
+
+func TestFillSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		enlarge       bool
+		wantW, wantH  int
+	}{
+		{name: "fill", width: 300, height: 300, wantW: 300, wantH: 300},
+		{name: "auto width", width: 0, height: 300, wantW: 400, wantH: 300},
+		{name: "auto height", width: 400, height: 0, wantW: 400, wantH: 300},
+		{name: "no enlarge", width: 1600, height: 0, wantW: 800, wantH: 600},
+		{name: "enlarge", width: 1600, height: 0, enlarge: true, wantW: 1600, wantH: 1200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := NewImage(testJPEG(t, 800, 600))
+			require.NoError(t, err)
+
+			data, err := img.Process(&ImgData{
+				Action: ImageActionFill, Width: tt.width, Height: tt.height, Enlarge: tt.enlarge,
+			}, Options{})
+			require.NoError(t, err)
+
+			w, h, err := Size(data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantW, w)
+			assert.Equal(t, tt.wantH, h)
+		})
+	}
+}
+
+func TestProcessAutoRotate(t *testing.T) {
+	src, err := vips.Black(800, 600)
+	require.NoError(t, err)
+	defer src.Close()
+
+	// 6 - снимок повёрнут на 90° по часовой стрелке.
+	require.NoError(t, src.SetOrientation(6))
+	source, _, err := src.ExportJpeg(vips.NewJpegExportParams())
+	require.NoError(t, err)
+
+	img, err := NewImage(source)
+	require.NoError(t, err)
+
+	data, err := img.Process(&ImgData{Action: ImageActionFill, Width: 300}, Options{})
+	require.NoError(t, err)
+
+	result, err := vips.NewImageFromBuffer(data)
+	require.NoError(t, err)
+	defer result.Close()
+
+	assert.Equal(t, 300, result.Width())
+	assert.Equal(t, 400, result.Height())
+	assert.LessOrEqual(t, result.Orientation(), 1)
+}
+
+func TestProcessAnimation(t *testing.T) {
+	source := testGIF(t, 200, 100, []int{100, 200, 300})
+
+	t.Run("all frames", func(t *testing.T) {
+		img, err := NewImage(source)
+		require.NoError(t, err)
+
+		data, err := img.Process(&ImgData{Action: ImageActionFill, Width: 50, Height: 50}, Options{})
+		require.NoError(t, err)
+
+		params := vips.NewImportParams()
+		params.NumPages.Set(-1)
+		result, err := vips.LoadImageFromBuffer(data, params)
+		require.NoError(t, err)
+		defer result.Close()
+
+		assert.Equal(t, vips.ImageTypeGIF, result.Format())
+		assert.Equal(t, 3, result.Pages())
+		assert.Equal(t, 50, result.Width())
+		assert.Equal(t, 50, result.PageHeight())
+
+		delay, err := result.PageDelay()
+		require.NoError(t, err)
+		assert.Equal(t, []int{100, 200, 300}, delay)
+		assert.Equal(t, 2, result.GetInt("loop"))
+	})
+
+	t.Run("still frame", func(t *testing.T) {
+		img, err := Load(source, 2)
+		require.NoError(t, err)
+
+		data, err := img.Process(&ImgData{Action: ImageActionFill, Width: 50, Format: vips.ImageTypePNG}, Options{})
+		require.NoError(t, err)
+
+		w, h, err := Size(data)
+		require.NoError(t, err)
+		assert.Equal(t, 50, w)
+		assert.Equal(t, 25, h)
+	})
+
+	t.Run("frame out of range", func(t *testing.T) {
+		_, err := Load(source, 4)
+		assert.ErrorIs(t, err, ErrOutOfBounds)
+	})
+}
+
+func TestSize(t *testing.T) {
+	w, h, err := Size(testJPEG(t, 30, 20))
+	require.NoError(t, err)
+	assert.Equal(t, 30, w)
+	assert.Equal(t, 20, h)
+
+	// У анимации возвращаются размеры одного кадра, как у ответа сервиса.
+	w, h, err = Size(testGIF(t, 200, 100, []int{100, 200, 300}))
+	require.NoError(t, err)
+	assert.Equal(t, 200, w)
+	assert.Equal(t, 100, h)
+
+	_, _, err = Size([]byte("not an image"))
+	assert.Error(t, err)
+}
+
+// testGIF создаёт анимацию из кадров width x height с задержками delay (мс).
+func testGIF(t *testing.T, width, height int, delay []int) []byte {
+	t.Helper()
+
+	img, err := vips.Black(width, height*len(delay))
+	require.NoError(t, err)
+	defer img.Close()
+
+	require.NoError(t, img.SetPageHeight(height))
+	require.NoError(t, img.SetPages(len(delay)))
+	require.NoError(t, img.SetPageDelay(delay))
+	img.SetInt("loop", 2)
+
+	data, _, err := img.ExportGIF(vips.NewGifExportParams())
+	require.NoError(t, err)
+
+	return data
+}
+
+func testJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img, err := vips.Black(width, height)
+	require.NoError(t, err)
+	defer img.Close()
+
+	data, _, err := img.ExportJpeg(vips.NewJpegExportParams())
+	require.NoError(t, err)
+
+	return data
+}
+
+func TestFocalOffset(t *testing.T) {
+	assert.Equal(t, 250, focalOffset(1000, 500, 0.5))
+	assert.Equal(t, 50, focalOffset(1000, 500, 0.3))
+	assert.Equal(t, 0, focalOffset(1000, 500, 0.1))
+	assert.Equal(t, 500, focalOffset(1000, 500, 0.9))
+	assert.Equal(t, 0, focalOffset(500, 500, 0.9))
+}
+
+func TestFillFocalPoint(t *testing.T) {
+	img, err := NewImage(testJPEG(t, 800, 600))
+	require.NoError(t, err)
+
+	imgData := &ImgData{
+		Action:     ImageActionFill,
+		Width:      300,
+		Height:     300,
+		Gravity:    GravityFocalPoint,
+		FocalPoint: FocalPoint{X: 0.9, Y: 0.1},
+	}
+	data, err := img.Process(imgData, Options{})
+	require.NoError(t, err)
+
+	w, h, err := Size(data)
+	require.NoError(t, err)
+	assert.Equal(t, 300, w)
+	assert.Equal(t, 300, h)
+
+	other := *imgData
+	other.FocalPoint = FocalPoint{X: 0.1, Y: 0.1}
+	assert.NotEqual(t, imgData.String(), other.String())
+}
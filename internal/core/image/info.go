@@ -0,0 +1,123 @@
+package image
+
+import (
+	"fmt"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// analysisSize - размер копии, по которой анализируются цвета.
+const analysisSize = 64
+
+// colorSpaces - имена цветовых пространств как в libvips.
+var colorSpaces = map[vips.Interpretation]string{
+	vips.InterpretationMultiband: "multiband",
+	vips.InterpretationBW:        "b-w",
+	vips.InterpretationXYZ:       "xyz",
+	vips.InterpretationLAB:       "lab",
+	vips.InterpretationCMYK:      "cmyk",
+	vips.InterpretationLABQ:      "labq",
+	vips.InterpretationRGB:       "rgb",
+	vips.InterpretationRGB16:     "rgb16",
+	vips.InterpretationCMC:       "cmc",
+	vips.InterpretationLCH:       "lch",
+	vips.InterpretationLABS:      "labs",
+	vips.InterpretationSRGB:      "srgb",
+	vips.InterpretationYXY:       "yxy",
+	vips.InterpretationGrey16:    "grey16",
+	vips.InterpretationScRGB:     "scrgb",
+	vips.InterpretationHSV:       "hsv",
+}
+
+// Color - цвет sRGB.
+type Color struct {
+	// Hex - цвет в виде #rrggbb.
+	Hex string `json:"hex"`
+	RGB [3]int `json:"rgb"`
+}
+
+func newColor(r, g, b int) Color {
+	return Color{Hex: fmt.Sprintf("#%02x%02x%02x", r, g, b), RGB: [3]int{r, g, b}}
+}
+
+// Info - сведения об исходном изображении. Размеры указаны без учёта
+// EXIF-ориентации, для анимации Height - высота одного кадра.
+type Info struct {
+	Format        string `json:"format"`
+	Width         int    `json:"width"`
+	Height        int    `json:"height"`
+	Pages         int    `json:"pages"`
+	ColorSpace    string `json:"colorSpace"`
+	HasAlpha      bool   `json:"hasAlpha"`
+	Orientation   int    `json:"orientation"`
+	Size          int    `json:"size"`
+	DominantColor Color  `json:"dominantColor"`
+	// Palette - основные цвета изображения по убыванию веса.
+	Palette []PaletteColor `json:"palette"`
+}
+
+// Info возвращает сведения об изображении. size - размер исходного файла в
+// байтах, colors - число цветов палитры. Цвета считаются по уменьшенной
+// копии первого кадра, поэтому после вызова изображение изменено.
+func (i *Image) Info(size, colors int) (*Info, error) {
+	info := &Info{
+		Format:      vips.ImageTypes[i.VipsImg.Format()],
+		Width:       i.VipsImg.Width(),
+		Height:      i.VipsImg.PageHeight(),
+		Pages:       i.VipsImg.Pages(),
+		ColorSpace:  colorSpaces[i.VipsImg.Interpretation()],
+		HasAlpha:    i.VipsImg.HasAlpha(),
+		Orientation: i.VipsImg.Orientation(),
+		Size:        size,
+	}
+
+	if err := i.importProfile(""); err != nil {
+		return nil, fmt.Errorf("failed to convert colour profile: %w", err)
+	}
+
+	pixels, _, _, err := i.rgbPixels(analysisSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare pixels: %w", err)
+	}
+	info.DominantColor = dominantColor(pixels)
+	info.Palette = palette(pixels, colors)
+
+	return info, nil
+}
+
+// dominantColor возвращает преобладающий цвет. Пиксели группируются по
+// старшим четырём битам каналов, результат - средний цвет самой большой
+// группы.
+func dominantColor(pixels []byte) Color {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+
+	var buckets [1 << 12]bucket
+	best := 0
+	for offset := 0; offset+2 < len(pixels); offset += 3 {
+		r, g, b := int(pixels[offset]), int(pixels[offset+1]), int(pixels[offset+2])
+
+		index := r>>4<<8 | g>>4<<4 | b>>4
+		buckets[index].count++
+		buckets[index].r += r
+		buckets[index].g += g
+		buckets[index].b += b
+
+		if buckets[index].count > buckets[best].count {
+			best = index
+		}
+	}
+
+	top := buckets[best]
+	if top.count == 0 {
+		return newColor(0, 0, 0)
+	}
+
+	return newColor(roundDiv(top.r, top.count), roundDiv(top.g, top.count), roundDiv(top.b, top.count))
+}
+
+func roundDiv(a, b int) int {
+	return (a + b/2) / b
+}
@@ -0,0 +1,88 @@
+package image
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInfo(t *testing.T) {
+	t.Run("jpeg", func(t *testing.T) {
+		source := testJPEG(t, 400, 300)
+		img, err := NewImage(source)
+		require.NoError(t, err)
+
+		info, err := img.Info(len(source), 3)
+		require.NoError(t, err)
+		assert.Equal(t, &Info{
+			Format:        "jpeg",
+			Width:         400,
+			Height:        300,
+			Pages:         1,
+			ColorSpace:    "b-w",
+			Size:          len(source),
+			DominantColor: Color{Hex: "#000000", RGB: [3]int{0, 0, 0}},
+			Palette:       []PaletteColor{{Color: Color{Hex: "#000000", RGB: [3]int{0, 0, 0}}, Weight: 1}},
+		}, info)
+	})
+
+	t.Run("animation", func(t *testing.T) {
+		source := testGIF(t, 40, 30, []int{100, 100, 100})
+		img, err := NewImage(source)
+		require.NoError(t, err)
+
+		info, err := img.Info(len(source), 3)
+		require.NoError(t, err)
+		assert.Equal(t, "gif", info.Format)
+		assert.Equal(t, 40, info.Width)
+		assert.Equal(t, 30, info.Height)
+		assert.Equal(t, 3, info.Pages)
+	})
+
+	t.Run("cmyk", func(t *testing.T) {
+		source, err := os.ReadFile("testdata/cmyk.jpg")
+		require.NoError(t, err)
+
+		img, err := NewImage(source)
+		require.NoError(t, err)
+
+		info, err := img.Info(len(source), 3)
+		require.NoError(t, err)
+		assert.Equal(t, "cmyk", info.ColorSpace)
+	})
+}
+
+func TestDominantColor(t *testing.T) {
+	// Три пикселя почти одинакового красного и один синий.
+	pixels := []byte{
+		250, 10, 10,
+		252, 12, 8,
+		254, 8, 12,
+		0, 0, 255,
+	}
+	assert.Equal(t, Color{Hex: "#fc0a0a", RGB: [3]int{252, 10, 10}}, dominantColor(pixels))
+	assert.Equal(t, Color{Hex: "#000000"}, dominantColor(nil))
+}
+
+func TestPalette(t *testing.T) {
+	// Три оттенка красного и один синий пиксель.
+	pixels := []byte{
+		250, 10, 10,
+		252, 12, 8,
+		254, 8, 12,
+		0, 0, 255,
+	}
+
+	assert.Equal(t, []PaletteColor{
+		{Color: Color{Hex: "#fc0a0a", RGB: [3]int{252, 10, 10}}, Weight: 0.75},
+		{Color: Color{Hex: "#0000ff", RGB: [3]int{0, 0, 255}}, Weight: 0.25},
+	}, palette(pixels, 2))
+
+	// Цветов в палитре не больше, чем различных цветов в изображении.
+	assert.Len(t, palette(pixels, 16), 4)
+	assert.Len(t, palette(pixels[:6], 16), 2)
+	assert.Len(t, palette([]byte{1, 2, 3, 1, 2, 3}, 16), 1)
+	assert.Nil(t, palette(nil, 5))
+}
@@ -0,0 +1,106 @@
+package image
+
+import (
+	"cmp"
+	"math"
+	"slices"
+)
+
+// PaletteColor - цвет палитры и доля пикселей, которые он представляет.
+type PaletteColor struct {
+	Color
+	Weight float64 `json:"weight"`
+}
+
+// palette строит палитру не более чем из size цветов методом медианного
+// сечения: группа пикселей с наибольшим разбросом делится по середине
+// самого широкого канала, пока групп не станет size. Цвет группы - средний
+// цвет её пикселей. Палитра упорядочена по убыванию веса.
+func palette(pixels []byte, size int) []PaletteColor {
+	total := len(pixels) / 3
+	if total == 0 || size < 1 {
+		return nil
+	}
+
+	all := make([][3]byte, total)
+	for i := range all {
+		copy(all[i][:], pixels[3*i:])
+	}
+
+	boxes := [][][3]byte{all}
+	for len(boxes) < size {
+		index, channel, spread := 0, 0, 0
+		for i, box := range boxes {
+			boxChannel, boxRange := widestChannel(box)
+			if score := boxRange * len(box); score > spread {
+				index, channel, spread = i, boxChannel, score
+			}
+		}
+		// Все группы состоят из пикселей одного цвета.
+		if spread == 0 {
+			break
+		}
+
+		box := boxes[index]
+		slices.SortFunc(box, func(a, b [3]byte) int {
+			return cmp.Compare(a[channel], b[channel])
+		})
+		split := splitIndex(box, channel)
+		boxes[index] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	colors := make([]PaletteColor, 0, len(boxes))
+	for _, box := range boxes {
+		var sum [3]int
+		for _, pixel := range box {
+			for channel := range sum {
+				sum[channel] += int(pixel[channel])
+			}
+		}
+
+		count := len(box)
+		colors = append(colors, PaletteColor{
+			Color:  newColor(roundDiv(sum[0], count), roundDiv(sum[1], count), roundDiv(sum[2], count)),
+			Weight: math.Round(float64(count)/float64(total)*1e4) / 1e4,
+		})
+	}
+
+	slices.SortStableFunc(colors, func(a, b PaletteColor) int {
+		return cmp.Compare(b.Weight, a.Weight)
+	})
+
+	return colors
+}
+
+// widestChannel возвращает канал с наибольшим диапазоном значений и этот
+// диапазон.
+func widestChannel(box [][3]byte) (int, int) {
+	low, high := [3]byte{255, 255, 255}, [3]byte{}
+	for _, pixel := range box {
+		for channel := range pixel {
+			low[channel] = min(low[channel], pixel[channel])
+			high[channel] = max(high[channel], pixel[channel])
+		}
+	}
+
+	widest, widestRange := 0, 0
+	for channel := range low {
+		if r := int(high[channel]) - int(low[channel]); r > widestRange {
+			widest, widestRange = channel, r
+		}
+	}
+
+	return widest, widestRange
+}
+
+// splitIndex возвращает индекс первого пикселя, значение канала которого
+// больше середины диапазона. Пиксели отсортированы по этому каналу, а
+// диапазон не нулевой, поэтому обе части не пустые.
+func splitIndex(box [][3]byte, channel int) int {
+	middle := (int(box[0][channel]) + int(box[len(box)-1][channel])) / 2
+	index, _ := slices.BinarySearchFunc(box, middle+1, func(pixel [3]byte, target int) int {
+		return cmp.Compare(int(pixel[channel]), target)
+	})
+	return index
+}
@@ -0,0 +1,497 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Stage определяет, когда выполняется операция относительно ресайза.
+type Stage int
+
+const (
+	StageBeforeResize Stage = iota
+	StageAfterResize
+)
+
+// Operation - шаг конвейера обработки.
+type Operation interface {
+	Apply(img *vips.ImageRef) error
+	Stage() Stage
+	// String возвращает канонический вид шага, который входит в ключ кэша.
+	String() string
+}
+
+type operationParser func(args []string) (Operation, error)
+
+// operations - доступные шаги конвейера по полному и короткому имени.
+var operations = map[string]operationParser{
+	"crop":    parseCrop,
+	"rotate":  parseRotate,
+	"rot":     parseRotate,
+	"flip":    parseFlip,
+	"fl":      parseFlip,
+	"blur":    parseBlur,
+	"bl":      parseBlur,
+	"sharpen": parseSharpen,
+	"sh":      parseSharpen,
+	"unsharp": parseSharpen,
+	"usm":     parseSharpen,
+
+	"grayscale":  parseGrayscale,
+	"gs":         parseGrayscale,
+	"sepia":      parseSepia,
+	"brightness": parseBrightness,
+	"br":         parseBrightness,
+	"contrast":   parseContrast,
+	"co":         parseContrast,
+	"saturation": parseSaturation,
+	"sat":        parseSaturation,
+	"gamma":      parseGamma,
+	"ga":         parseGamma,
+}
+
+// ParseOperation создаёт шаг конвейера по имени и аргументам.
+func ParseOperation(name string, args []string) (Operation, error) {
+	parse, ok := operations[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown operation: %q", name)
+	}
+
+	op, err := parse(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s arguments: %w", name, err)
+	}
+
+	return op, nil
+}
+
+// ParseSteps разбирает список шагов вида rot:90,bl:2 и проверяет их порядок.
+func ParseSteps(value string) ([]Operation, error) {
+	var steps []Operation
+	for _, step := range strings.Split(value, ",") {
+		name, rawArgs, _ := strings.Cut(step, ":")
+
+		var args []string
+		if rawArgs != "" {
+			args = strings.Split(rawArgs, ":")
+		}
+
+		op, err := ParseOperation(name, args)
+		if err != nil {
+			return nil, fmt.Errorf("invalid step %q: %w", step, err)
+		}
+		steps = append(steps, op)
+	}
+
+	if err := CheckSteps(steps); err != nil {
+		return nil, err
+	}
+
+	return steps, nil
+}
+
+// CheckSteps проверяет порядок шагов. Шаги выполняются в том порядке, в
+// котором указаны в запросе, а ресайз стоит между шагами до и после него,
+// поэтому шаг до ресайза не может идти после шага, выполняемого после ресайза.
+func CheckSteps(steps []Operation) error {
+	_, _, err := splitSteps(steps)
+	return err
+}
+
+// splitSteps делит шаги на выполняемые до и после ресайза, не меняя их порядок.
+func splitSteps(steps []Operation) ([]Operation, []Operation, error) {
+	for i, step := range steps {
+		if step.Stage() != StageAfterResize {
+			continue
+		}
+
+		for _, next := range steps[i+1:] {
+			if next.Stage() == StageBeforeResize {
+				return nil, nil, fmt.Errorf("step %s must come before %s: crop, rotate and flip run before resize",
+					next, step)
+			}
+		}
+		return steps[:i], steps[i:], nil
+	}
+	return steps, nil, nil
+}
+
+// stepsKey возвращает канонический список шагов в порядке их выполнения.
+func stepsKey(steps []Operation) string {
+	names := make([]string, 0, len(steps))
+	for _, step := range steps {
+		names = append(names, step.String())
+	}
+	return strings.Join(names, ",")
+}
+
+func (i *Image) apply(steps []Operation) error {
+	for _, step := range steps {
+		if err := step.Apply(i.VipsImg); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", step, err)
+		}
+	}
+	return nil
+}
+
+// cropValue - координата или размер области в пикселях или процентах от
+// соответствующей стороны исходника.
+type cropValue struct {
+	value   float64
+	percent bool
+}
+
+func parseCropValue(arg string) (cropValue, error) {
+	raw, percent := strings.CutSuffix(arg, "%")
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+		return cropValue{}, fmt.Errorf("invalid crop value %q", arg)
+	}
+
+	if percent && value > 100 {
+		return cropValue{}, fmt.Errorf("crop value %q is greater than 100%%", arg)
+	}
+
+	if !percent && value != math.Trunc(value) {
+		return cropValue{}, fmt.Errorf("crop value %q must be an integer number of pixels", arg)
+	}
+
+	// Ограничение не даёт сумме координаты и размера переполнить int при
+	// проверке границ.
+	if !percent && value > math.MaxInt32 {
+		return cropValue{}, fmt.Errorf("crop value %q is greater than %d", arg, math.MaxInt32)
+	}
+
+	return cropValue{value: value, percent: percent}, nil
+}
+
+func (v cropValue) pixels(side int) int {
+	if v.percent {
+		return int(math.Round(v.value * float64(side) / 100))
+	}
+	return int(v.value)
+}
+
+func (v cropValue) String() string {
+	if v.percent {
+		return formatFloat(v.value) + "%"
+	}
+	return formatFloat(v.value)
+}
+
+type cropOperation struct {
+	left, top, width, height cropValue
+}
+
+func parseCrop(args []string) (Operation, error) {
+	if len(args) != 4 {
+		return nil, fmt.Errorf("expected 4 arguments, got %d", len(args))
+	}
+
+	values := make([]cropValue, 0, len(args))
+	for _, arg := range args {
+		value, err := parseCropValue(arg)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	op := &cropOperation{left: values[0], top: values[1], width: values[2], height: values[3]}
+	if op.width.value == 0 || op.height.value == 0 {
+		return nil, errors.New("crop width and height must be positive")
+	}
+
+	return op, nil
+}
+
+// Apply вырезает область. Область проверяется по размерам декодированного
+// изображения, поэтому выход за его границы возвращает ErrOutOfBounds. У
+// анимации область вырезается из каждого кадра.
+func (op *cropOperation) Apply(img *vips.ImageRef) error {
+	imgWidth, imgHeight := img.Width(), img.PageHeight()
+	left, top := op.left.pixels(imgWidth), op.top.pixels(imgHeight)
+	width, height := op.width.pixels(imgWidth), op.height.pixels(imgHeight)
+
+	if width == 0 || height == 0 || left+width > imgWidth || top+height > imgHeight {
+		return fmt.Errorf("%w: crop area %d,%d %dx%d is outside of %dx%d image",
+			ErrOutOfBounds, left, top, width, height, imgWidth, imgHeight)
+	}
+
+	return img.ExtractArea(left, top, width, height)
+}
+
+func (op *cropOperation) Stage() Stage {
+	return StageBeforeResize
+}
+
+func (op *cropOperation) String() string {
+	return fmt.Sprintf("crop:%s:%s:%s:%s", op.left, op.top, op.width, op.height)
+}
+
+// defaultRotateBackground - заливка углов при повороте на произвольный угол.
+var defaultRotateBackground = vips.ColorRGBA{R: 255, G: 255, B: 255, A: 255}
+
+// rotateOperation поворачивает изображение по часовой стрелке. Повороты на
+// 90, 180 и 270 градусов выполняются без потерь, при остальных углах холст
+// расширяется до повёрнутых границ, а углы заливаются цветом background.
+type rotateOperation struct {
+	angle      float64
+	background vips.ColorRGBA
+}
+
+var angles = map[float64]vips.Angle{
+	90:  vips.Angle90,
+	180: vips.Angle180,
+	270: vips.Angle270,
+}
+
+func parseRotate(args []string) (Operation, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("expected 1 or 2 arguments, got %d", len(args))
+	}
+
+	value, err := strconv.ParseFloat(args[0], 64)
+	if err != nil || math.IsInf(value, 0) || math.IsNaN(value) {
+		return nil, fmt.Errorf("invalid angle %q", args[0])
+	}
+
+	angle := math.Mod(value, 360)
+	if angle < 0 {
+		angle += 360
+	}
+	if angle == 0 {
+		return nil, fmt.Errorf("angle %s is a multiple of 360", args[0])
+	}
+
+	op := &rotateOperation{angle: angle, background: defaultRotateBackground}
+	if len(args) == 2 {
+		if op.background, err = ParseColor(args[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return op, nil
+}
+
+func (op *rotateOperation) Apply(img *vips.ImageRef) error {
+	// Повороты на 90 и 270 градусов govips выполняет для каждого кадра сам,
+	// а поворот всей полосы на 180 поменял бы порядок кадров.
+	if op.angle == 180 {
+		return eachFrame(img, func(frame *vips.ImageRef) error { return frame.Rotate(vips.Angle180) })
+	}
+	if angle, ok := angles[op.angle]; ok {
+		return img.Rotate(angle)
+	}
+
+	if img.Height() > img.PageHeight() {
+		return fmt.Errorf("%w: rotation of animated image by %s degrees", ErrUnsupported, formatFloat(op.angle))
+	}
+
+	// Цвет заливки задаётся в sRGB, а прозрачной заливке нужен альфа-канал.
+	if img.Bands() < 3 {
+		if err := img.ToColorSpace(vips.InterpretationSRGB); err != nil {
+			return err
+		}
+	}
+	if op.background.A < 255 && !img.HasAlpha() {
+		if err := img.AddAlpha(); err != nil {
+			return err
+		}
+	}
+
+	return img.Similarity(1, op.angle, &op.background, 0, 0, 0, 0)
+}
+
+func (op *rotateOperation) Stage() Stage {
+	return StageBeforeResize
+}
+
+func (op *rotateOperation) String() string {
+	if _, ok := angles[op.angle]; ok || op.background == defaultRotateBackground {
+		return "rotate:" + formatFloat(op.angle)
+	}
+	return "rotate:" + formatFloat(op.angle) + ":" + formatColor(op.background)
+}
+
+type flipOperation struct {
+	direction string
+}
+
+var directions = map[string]vips.Direction{
+	"h": vips.DirectionHorizontal,
+	"v": vips.DirectionVertical,
+}
+
+func parseFlip(args []string) (Operation, error) {
+	if len(args) != 1 {
+		return nil, errors.New("expected direction h or v")
+	}
+
+	direction := strings.ToLower(args[0])
+	if _, ok := directions[direction]; !ok {
+		return nil, fmt.Errorf("direction must be h or v, got %q", args[0])
+	}
+
+	return &flipOperation{direction: direction}, nil
+}
+
+func (op *flipOperation) Apply(img *vips.ImageRef) error {
+	direction := directions[op.direction]
+	if direction == vips.DirectionHorizontal {
+		return img.Flip(direction)
+	}
+	return eachFrame(img, func(frame *vips.ImageRef) error { return frame.Flip(direction) })
+}
+
+func (op *flipOperation) Stage() Stage {
+	return StageBeforeResize
+}
+
+func (op *flipOperation) String() string {
+	return "flip:" + op.direction
+}
+
+type blurOperation struct {
+	sigma float64
+}
+
+func parseBlur(args []string) (Operation, error) {
+	sigma, err := floatArg(args, 0.1, 100)
+	if err != nil {
+		return nil, err
+	}
+	return &blurOperation{sigma: sigma}, nil
+}
+
+func (op *blurOperation) Apply(img *vips.ImageRef) error {
+	return eachFrame(img, func(frame *vips.ImageRef) error { return frame.GaussianBlur(op.sigma) })
+}
+
+func (op *blurOperation) Stage() Stage {
+	return StageAfterResize
+}
+
+func (op *blurOperation) String() string {
+	return "blur:" + formatFloat(op.sigma)
+}
+
+// defaultSharpenAmount - значение m2 по умолчанию в vips_sharpen.
+const defaultSharpenAmount = 3
+
+// sharpenOperation - нерезкое маскирование. После уменьшения изображения
+// возвращает резкость, потерянную при ресайзе.
+type sharpenOperation struct {
+	sigma  float64
+	amount float64
+}
+
+func parseSharpen(args []string) (Operation, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, fmt.Errorf("expected 1 or 2 arguments, got %d", len(args))
+	}
+
+	sigma, err := floatArg(args[:1], 0.1, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := float64(defaultSharpenAmount)
+	if len(args) == 2 {
+		if amount, err = floatArg(args[1:], 0, 20); err != nil {
+			return nil, err
+		}
+	}
+
+	return &sharpenOperation{sigma: sigma, amount: amount}, nil
+}
+
+func (op *sharpenOperation) Apply(img *vips.ImageRef) error {
+	// Параметр x1 соответствует значению по умолчанию vips_sharpen.
+	return eachFrame(img, func(frame *vips.ImageRef) error { return frame.Sharpen(op.sigma, 2, op.amount) })
+}
+
+func (op *sharpenOperation) Stage() Stage {
+	return StageAfterResize
+}
+
+func (op *sharpenOperation) String() string {
+	if op.amount == defaultSharpenAmount {
+		return "sharpen:" + formatFloat(op.sigma)
+	}
+	return "sharpen:" + formatFloat(op.sigma) + ":" + formatFloat(op.amount)
+}
+
+// eachFrame применяет fn к каждому кадру анимации отдельно. Кадры лежат друг
+// под другом, поэтому отражение всей полосы по вертикали поменяло бы их
+// порядок, а размытие смешало бы соседние кадры.
+func eachFrame(img *vips.ImageRef, fn func(frame *vips.ImageRef) error) error {
+	pageHeight := img.PageHeight()
+	pages := img.Height() / pageHeight
+	if pages <= 1 {
+		return fn(img)
+	}
+
+	frames := make([]*vips.ImageRef, 0, pages-1)
+	defer func() {
+		for _, frame := range frames {
+			frame.Close()
+		}
+	}()
+
+	for page := 1; page < pages; page++ {
+		frame, err := img.Copy()
+		if err != nil {
+			return err
+		}
+		frames = append(frames, frame)
+
+		if err := frame.Crop(0, page*pageHeight, frame.Width(), pageHeight); err != nil {
+			return err
+		}
+		if err := fn(frame); err != nil {
+			return err
+		}
+	}
+
+	// Первый кадр обрабатывается в img, чтобы склеенный результат сохранил
+	// метаданные анимации: задержки кадров и число повторов.
+	if err := img.Crop(0, 0, img.Width(), pageHeight); err != nil {
+		return err
+	}
+	if err := fn(img); err != nil {
+		return err
+	}
+
+	frameHeight := img.Height()
+	if err := img.ArrayJoin(frames, 1); err != nil {
+		return err
+	}
+	return img.SetPageHeight(frameHeight)
+}
+
+func floatArg(args []string, minValue, maxValue float64) (float64, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected 1 argument, got %d", len(args))
+	}
+
+	value, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", args[0])
+	}
+	if math.IsNaN(value) || value < minValue || value > maxValue {
+		return 0, fmt.Errorf("value %g is out of range [%g, %g]", value, minValue, maxValue)
+	}
+
+	return value, nil
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,324 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOperation(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "crop", args: []string{"10", "20", "100", "50"}, want: "crop:10:20:100:50"},
+		{name: "crop", args: []string{"10%", "0", "50.0%", "25%"}, want: "crop:10%:0:50%:25%"},
+		{name: "rot", args: []string{"450"}, want: "rotate:90"},
+		{name: "rot", args: []string{"-90"}, want: "rotate:270"},
+		{name: "rot", args: []string{"45"}, want: "rotate:45"},
+		{name: "rot", args: []string{"-15.5", "FFFFFF"}, want: "rotate:344.5"},
+		{name: "rot", args: []string{"30", "00000000"}, want: "rotate:30:00000000"},
+		{name: "rot", args: []string{"90", "ff0000"}, want: "rotate:90"},
+		{name: "fl", args: []string{"H"}, want: "flip:h"},
+		{name: "bl", args: []string{"2.50"}, want: "blur:2.5"},
+		{name: "sharpen", args: []string{"1"}, want: "sharpen:1"},
+		{name: "usm", args: []string{"0.5", "3"}, want: "sharpen:0.5"},
+		{name: "usm", args: []string{"0.5", "1.5"}, want: "sharpen:0.5:1.5"},
+		{name: "gs", want: "grayscale"},
+		{name: "sepia", want: "sepia"},
+		{name: "br", args: []string{"-20"}, want: "brightness:-20"},
+		{name: "co", args: []string{"1.2"}, want: "contrast:1.2"},
+		{name: "sat", args: []string{"0"}, want: "saturation:0"},
+		{name: "ga", args: []string{"2.2"}, want: "gamma:2.2"},
+		{name: "crop", args: []string{"10", "20", "0", "50"}, wantErr: true},
+		{name: "crop", args: []string{"NaN%", "0", "50%", "50%"}, wantErr: true},
+		{name: "crop", args: []string{"0", "0", "Inf", "50"}, wantErr: true},
+		{name: "crop", args: []string{"1e300", "0", "100", "50"}, wantErr: true},
+		{name: "crop", args: []string{"0", "0", "4294967296", "50"}, wantErr: true},
+		{name: "rotate", args: []string{"720"}, wantErr: true},
+		{name: "rotate", args: []string{"NaN"}, wantErr: true},
+		{name: "rotate", args: []string{"45", "red"}, wantErr: true},
+		{name: "flip", args: []string{"x"}, wantErr: true},
+		{name: "blur", args: []string{"1000"}, wantErr: true},
+		{name: "bl", args: []string{"NaN"}, wantErr: true},
+		{name: "sh", args: []string{"NaN"}, wantErr: true},
+		{name: "sharpen", args: []string{"1", "NaN"}, wantErr: true},
+		{name: "sharpen", args: []string{"1", "30"}, wantErr: true},
+		{name: "sharpen", args: []string{"1", "2", "3"}, wantErr: true},
+		{name: "grayscale", args: []string{"1"}, wantErr: true},
+		{name: "brightness", args: []string{"300"}, wantErr: true},
+		{name: "br", args: []string{"NaN"}, wantErr: true},
+		{name: "br", args: []string{"-Inf"}, wantErr: true},
+		{name: "contrast", args: []string{"-1"}, wantErr: true},
+		{name: "saturation", args: []string{"4"}, wantErr: true},
+		{name: "gamma", args: []string{"0"}, wantErr: true},
+		{name: "ga", args: []string{"NaN"}, wantErr: true},
+		{name: "unknown", args: []string{"1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, err := ParseOperation(tt.name, tt.args)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, op.String())
+		})
+	}
+}
+
+func TestParseSteps(t *testing.T) {
+	steps, err := ParseSteps("rot:90,FL:h,bl:2,gs")
+	require.NoError(t, err)
+	require.Len(t, steps, 4)
+	assert.Equal(t, "rotate:90,flip:h,blur:2,grayscale", stepsKey(steps))
+
+	for _, value := range []string{"", "rot:90,", "rot:90,bl", "unknown:1", "bl:2,rot:90"} {
+		_, err := ParseSteps(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestStepsKey(t *testing.T) {
+	blur, err := ParseOperation("blur", []string{"2"})
+	require.NoError(t, err)
+	rotate, err := ParseOperation("rotate", []string{"90"})
+	require.NoError(t, err)
+	flip, err := ParseOperation("flip", []string{"v"})
+	require.NoError(t, err)
+
+	// Ключ повторяет порядок шагов в запросе.
+	assert.Equal(t, "rotate:90,flip:v,blur:2", stepsKey([]Operation{rotate, flip, blur}))
+	assert.Equal(t, "flip:v,rotate:90,blur:2", stepsKey([]Operation{flip, rotate, blur}))
+
+	first := &ImgData{ImageURL: "http://example.com/a.jpg", Steps: []Operation{flip, rotate}}
+	second := &ImgData{ImageURL: "http://example.com/a.jpg", Steps: []Operation{rotate, flip}}
+	assert.NotEqual(t, first.String(), second.String())
+
+	// Шаг до ресайза после шага после ресайза не переставляется, а отклоняется.
+	assert.NoError(t, CheckSteps([]Operation{rotate, flip, blur}))
+	assert.ErrorContains(t, CheckSteps([]Operation{blur, rotate}), "rotate:90 must come before blur:2")
+	assert.Error(t, CheckSteps([]Operation{rotate, blur, flip}))
+}
+
+func TestProcessSteps(t *testing.T) {
+	img, err := NewImage(testJPEG(t, 800, 600))
+	require.NoError(t, err)
+
+	rotate, err := ParseOperation("rotate", []string{"90"})
+	require.NoError(t, err)
+	blur, err := ParseOperation("blur", []string{"1"})
+	require.NoError(t, err)
+
+	_, err = img.Process(&ImgData{Action: ImageActionFill, Width: 300, Steps: []Operation{blur, rotate}}, Options{})
+	require.Error(t, err)
+
+	data, err := img.Process(&ImgData{Action: ImageActionFill, Width: 300, Steps: []Operation{rotate, blur}}, Options{})
+	require.NoError(t, err)
+
+	w, h, err := Size(data)
+	require.NoError(t, err)
+	assert.Equal(t, 300, w)
+	assert.Equal(t, 400, h)
+}
+
+func TestProcessRotate(t *testing.T) {
+	t.Run("arbitrary angle", func(t *testing.T) {
+		img, err := NewImage(testJPEG(t, 800, 600))
+		require.NoError(t, err)
+
+		rotate, err := ParseOperation("rotate", []string{"45"})
+		require.NoError(t, err)
+
+		data, err := img.Process(&ImgData{Action: ImageActionCrop, Format: vips.ImageTypePNG, Steps: []Operation{rotate}},
+			Options{})
+		require.NoError(t, err)
+
+		result, err := vips.NewImageFromBuffer(data)
+		require.NoError(t, err)
+		defer result.Close()
+
+		// Холст расширяется до границ повёрнутого изображения: (800+600)/√2.
+		assert.InDelta(t, 990, result.Width(), 2)
+		assert.InDelta(t, 990, result.Height(), 2)
+
+		corner, err := result.GetPoint(0, 0)
+		require.NoError(t, err)
+		assert.Equal(t, []float64{255, 255, 255}, corner)
+
+		center, err := result.GetPoint(result.Width()/2, result.Height()/2)
+		require.NoError(t, err)
+		assert.Equal(t, []float64{0, 0, 0}, center)
+	})
+
+	t.Run("resize after rotation", func(t *testing.T) {
+		img, err := NewImage(testJPEG(t, 800, 600))
+		require.NoError(t, err)
+
+		rotate, err := ParseOperation("rotate", []string{"270"})
+		require.NoError(t, err)
+		flip, err := ParseOperation("flip", []string{"h"})
+		require.NoError(t, err)
+
+		data, err := img.Process(&ImgData{Action: ImageActionFill, Width: 150, Steps: []Operation{rotate, flip}}, Options{})
+		require.NoError(t, err)
+
+		w, h, err := Size(data)
+		require.NoError(t, err)
+		assert.Equal(t, 150, w)
+		assert.Equal(t, 200, h)
+	})
+
+	t.Run("animation", func(t *testing.T) {
+		img, err := Load(testGIF(t, 40, 30, []int{100, 100}), 0)
+		require.NoError(t, err)
+
+		rotate, err := ParseOperation("rotate", []string{"30"})
+		require.NoError(t, err)
+
+		_, err = img.Process(&ImgData{Action: ImageActionCrop, Steps: []Operation{rotate}}, Options{})
+		assert.ErrorIs(t, err, ErrUnsupported)
+	})
+}
+
+func TestProcessCrop(t *testing.T) {
+	t.Run("percentage", func(t *testing.T) {
+		img, err := NewImage(testJPEG(t, 800, 600))
+		require.NoError(t, err)
+
+		crop, err := ParseOperation("crop", []string{"25%", "0", "50%", "50%"})
+		require.NoError(t, err)
+
+		data, err := img.Process(&ImgData{Action: ImageActionCrop, Steps: []Operation{crop}}, Options{})
+		require.NoError(t, err)
+
+		w, h, err := Size(data)
+		require.NoError(t, err)
+		assert.Equal(t, 400, w)
+		assert.Equal(t, 300, h)
+	})
+
+	t.Run("out of bounds", func(t *testing.T) {
+		img, err := NewImage(testJPEG(t, 800, 600))
+		require.NoError(t, err)
+
+		crop, err := ParseOperation("crop", []string{"600", "0", "300", "300"})
+		require.NoError(t, err)
+
+		_, err = img.Process(&ImgData{Action: ImageActionCrop, Steps: []Operation{crop}}, Options{})
+		assert.ErrorIs(t, err, ErrOutOfBounds)
+	})
+}
+
+func TestProcessAnimationSteps(t *testing.T) {
+	// Верхняя половина каждого кадра залита своей яркостью, нижняя - чёрная.
+	levels := []float64{60, 120, 180}
+	source := testStripedGIF(t, 40, 20, levels)
+
+	process := func(t *testing.T, name string, args ...string) *vips.ImageRef {
+		t.Helper()
+
+		op, err := ParseOperation(name, args)
+		require.NoError(t, err)
+
+		img, err := NewImage(source)
+		require.NoError(t, err)
+
+		data, err := img.Process(&ImgData{Action: ImageActionCrop, Steps: []Operation{op}}, Options{})
+		require.NoError(t, err)
+
+		params := vips.NewImportParams()
+		params.NumPages.Set(-1)
+		result, err := vips.LoadImageFromBuffer(data, params)
+		require.NoError(t, err)
+		t.Cleanup(result.Close)
+
+		require.Equal(t, len(levels), result.Pages())
+		require.Equal(t, 20, result.PageHeight())
+
+		delay, err := result.PageDelay()
+		require.NoError(t, err)
+		assert.Equal(t, []int{100, 200, 300}, delay)
+
+		return result
+	}
+
+	pixel := func(t *testing.T, img *vips.ImageRef, x, y int) float64 {
+		t.Helper()
+
+		point, err := img.GetPoint(x, y)
+		require.NoError(t, err)
+		return point[0]
+	}
+
+	// Отражается каждый кадр, а порядок кадров сохраняется.
+	for _, step := range [][]string{{"rotate", "180"}, {"flip", "v"}} {
+		t.Run(step[0], func(t *testing.T) {
+			result := process(t, step[0], step[1:]...)
+
+			for page, level := range levels {
+				top := page * result.PageHeight()
+				assert.InDelta(t, 0, pixel(t, result, 20, top+5), 8, "frame %d", page)
+				assert.InDelta(t, level, pixel(t, result, 20, top+15), 8, "frame %d", page)
+			}
+		})
+	}
+
+	t.Run("blur", func(t *testing.T) {
+		result := process(t, "blur", "2")
+
+		// Верхний край кадра не смешивается с чёрной нижней частью предыдущего.
+		for page, level := range levels {
+			assert.InDelta(t, level, pixel(t, result, 20, page*result.PageHeight()), 8, "frame %d", page)
+		}
+	})
+}
+
+// testStripedGIF создаёт анимацию из кадров width x height, у которых верхняя
+// половина имеет яркость levels[i], а нижняя - чёрная. Задержки кадров
+// 100, 200, 300... мс.
+func testStripedGIF(t *testing.T, width, height int, levels []float64) []byte {
+	t.Helper()
+
+	parts := make([]*vips.ImageRef, 0, len(levels)*2)
+	defer func() {
+		for _, part := range parts {
+			part.Close()
+		}
+	}()
+
+	delay := make([]int, 0, len(levels))
+	for i, level := range levels {
+		top, err := vips.Black(width, height/2)
+		require.NoError(t, err)
+		parts = append(parts, top)
+		require.NoError(t, top.Linear1(1, level))
+
+		bottom, err := vips.Black(width, height/2)
+		require.NoError(t, err)
+		parts = append(parts, bottom)
+
+		delay = append(delay, (i+1)*100)
+	}
+
+	img, err := parts[0].Copy()
+	require.NoError(t, err)
+	defer img.Close()
+
+	require.NoError(t, img.ArrayJoin(parts[1:], 1))
+	require.NoError(t, img.Cast(vips.BandFormatUchar))
+	require.NoError(t, img.SetPageHeight(height))
+	require.NoError(t, img.SetPages(len(levels)))
+	require.NoError(t, img.SetPageDelay(delay))
+
+	data, _, err := img.ExportGIF(vips.NewGifExportParams())
+	require.NoError(t, err)
+
+	return data
+}
@@ -0,0 +1,209 @@
+package image
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+const (
+	// blurHashSize - размер копии, по которой считается BlurHash. Хеш
+	// передаёт только низкие частоты, поэтому большего разрешения не нужно.
+	blurHashSize = 32
+	// lqipBlur и lqipQuality - размытие и качество WebP для LQIP.
+	lqipBlur    = 1
+	lqipQuality = 30
+)
+
+// blurHashChars - алфавит base83 из спецификации BlurHash.
+const blurHashChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// BlurHash возвращает BlurHash первого кадра изображения: 4x3 компоненты
+// для горизонтальных изображений и 3x4 для вертикальных.
+func (i *Image) BlurHash() (string, error) {
+	if err := i.VipsImg.AutoRotate(); err != nil {
+		return "", fmt.Errorf("failed to auto-rotate image: %w", err)
+	}
+
+	if err := i.importProfile(""); err != nil {
+		return "", fmt.Errorf("failed to convert colour profile: %w", err)
+	}
+
+	pixels, width, height, err := i.rgbPixels(blurHashSize)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare pixels: %w", err)
+	}
+
+	xComponents, yComponents := 4, 3
+	if height > width {
+		xComponents, yComponents = 3, 4
+	}
+
+	return encodeBlurHash(pixels, width, height, xComponents, yComponents), nil
+}
+
+// LQIP возвращает data URI размытой копии первого кадра шириной width. Копия
+// не бывает больше исходника.
+func (i *Image) LQIP(width int) (string, error) {
+	if i.animated() {
+		if err := i.firstFrame(); err != nil {
+			return "", fmt.Errorf("failed to extract first frame: %w", err)
+		}
+	}
+
+	data, err := i.Process(&ImgData{
+		Action:  ImageActionFill,
+		Width:   width,
+		Format:  vips.ImageTypeWEBP,
+		Quality: lqipQuality,
+		Steps:   []Operation{&blurOperation{sigma: lqipBlur}},
+	}, Options{})
+	if err != nil {
+		return "", err
+	}
+
+	return "data:" + ContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// rgbPixels уменьшает первый кадр так, чтобы большая сторона не превышала
+// size, и возвращает его пиксели в sRGB по три байта. Прозрачные области
+// заливаются белым.
+func (i *Image) rgbPixels(size int) ([]byte, int, int, error) {
+	if i.animated() {
+		if err := i.firstFrame(); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	if scale := float64(size) / float64(max(i.VipsImg.Width(), i.VipsImg.Height())); scale < 1 {
+		if err := i.VipsImg.Resize(scale, vips.KernelLinear); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	if err := i.VipsImg.ToColorSpace(vips.InterpretationSRGB); err != nil {
+		return nil, 0, 0, err
+	}
+
+	if i.VipsImg.HasAlpha() {
+		if err := i.VipsImg.Flatten(&vips.Color{R: 255, G: 255, B: 255}); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	if err := i.VipsImg.Cast(vips.BandFormatUchar); err != nil {
+		return nil, 0, 0, err
+	}
+
+	pixels, err := i.VipsImg.ToBytes()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	return pixels, i.VipsImg.Width(), i.VipsImg.Height(), nil
+}
+
+// encodeBlurHash кодирует пиксели RGB по алгоритму BlurHash
+// (https://github.com/woltapp/blurhash).
+func encodeBlurHash(pixels []byte, width, height, xComponents, yComponents int) string {
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for y := range yComponents {
+		for x := range xComponents {
+			factors = append(factors, blurHashFactor(pixels, width, height, x, y))
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encode83((xComponents-1)+(yComponents-1)*9, 1))
+
+	maxValue := 1.0
+	if ac := factors[1:]; len(ac) > 0 {
+		actualMax := 0.0
+		for _, factor := range ac {
+			for _, value := range factor {
+				actualMax = math.Max(actualMax, math.Abs(value))
+			}
+		}
+
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encode83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encode83(0, 1))
+	}
+
+	dc := factors[0]
+	hash.WriteString(encode83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	for _, factor := range factors[1:] {
+		value := 0
+		for _, channel := range factor {
+			quantised := math.Floor(signPow(channel/maxValue, 0.5)*9 + 9.5)
+			value = value*19 + int(math.Max(0, math.Min(18, quantised)))
+		}
+		hash.WriteString(encode83(value, 2))
+	}
+
+	return hash.String()
+}
+
+// blurHashFactor - коэффициент косинусного преобразования для компоненты x, y.
+func blurHashFactor(pixels []byte, width, height, x, y int) [3]float64 {
+	normalisation := 2.0
+	if x == 0 && y == 0 {
+		normalisation = 1
+	}
+
+	var factor [3]float64
+	for py := range height {
+		for px := range width {
+			basis := normalisation *
+				math.Cos(math.Pi*float64(x*px)/float64(width)) *
+				math.Cos(math.Pi*float64(y*py)/float64(height))
+
+			offset := 3 * (py*width + px)
+			for channel := range factor {
+				factor[channel] += basis * sRGBToLinear(pixels[offset+channel])
+			}
+		}
+	}
+
+	scale := 1 / float64(width*height)
+	for channel := range factor {
+		factor[channel] *= scale
+	}
+
+	return factor
+}
+
+func encode83(value, length int) string {
+	result := make([]byte, length)
+	for i := range length {
+		digit := value / int(math.Pow(83, float64(length-i-1))) % 83
+		result[i] = blurHashChars[digit]
+	}
+	return string(result)
+}
+
+func sRGBToLinear(value byte) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
@@ -0,0 +1,77 @@
+package image
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeBlurHash(t *testing.T) {
+	white := make([]byte, 3*8*6)
+	for i := range white {
+		white[i] = 255
+	}
+
+	hash := encodeBlurHash(white, 8, 6, 4, 3)
+	assert.Equal(t, "LsTSUA_3fQ_3~qt7fQt7fQfQfQfQ", hash)
+	// Символ размера, максимум AC, 4 символа DC и по 2 на 11 компонент AC.
+	assert.Len(t, hash, 28)
+
+	assert.Equal(t, "TSUA", encode83(0xffffff, 4))
+	assert.Equal(t, "00", encode83(0, 2))
+}
+
+func TestBlurHash(t *testing.T) {
+	t.Run("landscape", func(t *testing.T) {
+		img, err := NewImage(testJPEG(t, 400, 300))
+		require.NoError(t, err)
+
+		hash, err := img.BlurHash()
+		require.NoError(t, err)
+		assert.Len(t, hash, 28)
+		// 4x3 компоненты, DC - чёрный.
+		assert.Equal(t, "L", hash[:1])
+		assert.Equal(t, "0000", hash[2:6])
+	})
+
+	t.Run("portrait", func(t *testing.T) {
+		img, err := NewImage(testJPEG(t, 300, 400))
+		require.NoError(t, err)
+
+		hash, err := img.BlurHash()
+		require.NoError(t, err)
+		// 3x4 компоненты.
+		assert.Equal(t, "T", hash[:1])
+	})
+
+	t.Run("animation", func(t *testing.T) {
+		img, err := Load(testGIF(t, 40, 30, []int{100, 100}), 0)
+		require.NoError(t, err)
+
+		hash, err := img.BlurHash()
+		require.NoError(t, err)
+		assert.Len(t, hash, 28)
+	})
+}
+
+func TestLQIP(t *testing.T) {
+	img, err := NewImage(testJPEG(t, 400, 300))
+	require.NoError(t, err)
+
+	uri, err := img.LQIP(16)
+	require.NoError(t, err)
+
+	encoded, ok := strings.CutPrefix(uri, "data:image/webp;base64,")
+	require.True(t, ok, uri)
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+
+	w, h, err := Size(data)
+	require.NoError(t, err)
+	assert.Equal(t, 16, w)
+	assert.Equal(t, 12, h)
+}
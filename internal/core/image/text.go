@@ -0,0 +1,173 @@
+package image
+
+import (
+	"fmt"
+	"html"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+const (
+	defaultFont     = "sans"
+	defaultFontSize = 24
+)
+
+// TextStyle - оформление текста, накладываемого на изображение.
+type TextStyle struct {
+	// Font - семейство шрифта, например "DejaVu Sans". Шрифт должен
+	// содержать кириллицу.
+	Font string
+	// Size - размер шрифта в пикселях.
+	Size  int
+	Color vips.ColorRGBA
+	// Background - цвет подложки. Нулевая альфа отключает подложку.
+	Background vips.ColorRGBA
+	// Padding - отступ текста от края подложки.
+	Padding  int
+	Position Position
+	// OffsetX и OffsetY - отступ подложки от края изображения.
+	OffsetX int
+	OffsetY int
+}
+
+// text накладывает текст в стиле name из реестра.
+func (i *Image) text(text, name string, styles map[string]TextStyle) error {
+	if text == "" {
+		return nil
+	}
+
+	style, ok := styles[name]
+	if !ok {
+		return fmt.Errorf("unknown text style: %q", name)
+	}
+
+	width, height := i.VipsImg.Width(), i.VipsImg.PageHeight()
+	layer, err := style.layer(text, width, height)
+	if err != nil {
+		return fmt.Errorf("failed to render text: %w", err)
+	}
+	if layer == nil {
+		return nil
+	}
+	defer layer.Close()
+
+	align := positions[style.Position]
+	err = layer.Embed(
+		alignOffset(align.x, width, layer.Width(), style.OffsetX),
+		alignOffset(align.y, height, layer.Height(), style.OffsetY),
+		width,
+		height,
+		vips.ExtendBlack,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := i.composite(layer); err != nil {
+		return fmt.Errorf("failed to apply text: %w", err)
+	}
+
+	return nil
+}
+
+// layer создаёт прозрачный слой с текстом на подложке. Текст переносится по
+// ширине изображения. Для текста без видимых символов возвращается nil.
+func (s TextStyle) layer(text string, width, height int) (*vips.ImageRef, error) {
+	mask, err := s.mask(text, width-2*(s.OffsetX+s.Padding), height)
+	if err != nil || mask == nil {
+		return nil, err
+	}
+	defer mask.Close()
+
+	textLayer, err := vips.Black(mask.Width(), mask.Height())
+	if err != nil {
+		return nil, err
+	}
+	defer textLayer.Close()
+
+	if err := paint(textLayer, s.Color); err != nil {
+		return nil, err
+	}
+	if err := mask.Linear1(float64(s.Color.A)/255, 0); err != nil {
+		return nil, err
+	}
+	if err := mask.Cast(vips.BandFormatUchar); err != nil {
+		return nil, err
+	}
+	if err := textLayer.BandJoin(mask); err != nil {
+		return nil, err
+	}
+
+	box, err := solid(textLayer.Width()+2*s.Padding, textLayer.Height()+2*s.Padding, s.Background)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := box.Composite(textLayer, vips.BlendModeOver, s.Padding, s.Padding); err != nil {
+		box.Close()
+		return nil, err
+	}
+
+	return box, nil
+}
+
+// mask рендерит текст средствами libvips (Pango) и возвращает одноканальную
+// маску, обрезанную по границам символов.
+func (s TextStyle) mask(text string, wrapWidth, height int) (*vips.ImageRef, error) {
+	canvas, err := vips.Black(max(wrapWidth, 1), height)
+	if err != nil {
+		return nil, err
+	}
+
+	font, size := s.Font, s.Size
+	if font == "" {
+		font = defaultFont
+	}
+	if size == 0 {
+		size = defaultFontSize
+	}
+
+	// Текст интерпретируется как разметка Pango, поэтому спецсимволы
+	// экранируются.
+	err = canvas.Label(&vips.LabelParams{
+		Text:      html.EscapeString(text),
+		Font:      fmt.Sprintf("%s %d", font, size),
+		Width:     vips.ValueOf(float64(max(wrapWidth, 1))),
+		Opacity:   1,
+		Color:     vips.Color{R: 255, G: 255, B: 255},
+		Alignment: textAlign(s.Position),
+	})
+	if err == nil {
+		// Label возвращает трёхканальное изображение, маске нужен один канал.
+		err = canvas.ExtractBand(0, 1)
+	}
+	if err != nil {
+		canvas.Close()
+		return nil, err
+	}
+
+	left, top, maskWidth, maskHeight, err := canvas.FindTrim(1, &vips.Color{})
+	if err != nil || maskWidth == 0 || maskHeight == 0 {
+		canvas.Close()
+		return nil, err
+	}
+
+	if err := canvas.ExtractArea(left, top, maskWidth, maskHeight); err != nil {
+		canvas.Close()
+		return nil, err
+	}
+
+	return canvas, nil
+}
+
+// textAlign выравнивает строки текста по той же стороне, что и подложку.
+func textAlign(position Position) vips.Align {
+	switch positions[position].x {
+	case -1:
+		return vips.AlignLow
+	case 1:
+		return vips.AlignHigh
+	default:
+		return vips.AlignCenter
+	}
+}
@@ -0,0 +1,66 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessText(t *testing.T) {
+	styles := map[string]TextStyle{
+		"title": {
+			Font:       "DejaVu Sans",
+			Size:       20,
+			Color:      vips.ColorRGBA{R: 255, G: 255, B: 255, A: 255},
+			Background: vips.ColorRGBA{R: 255, A: 255},
+			Padding:    4,
+			Position:   PositionSouth,
+		},
+	}
+
+	t.Run("cyrillic caption", func(t *testing.T) {
+		img, err := NewImage(testJPEG(t, 300, 200))
+		require.NoError(t, err)
+
+		data, err := img.Process(&ImgData{
+			Action: ImageActionCrop, Format: vips.ImageTypePNG, Text: "Съешь ещё этих булок", TextStyle: "title",
+		}, Options{TextStyles: styles})
+		require.NoError(t, err)
+
+		result, err := vips.NewImageFromBuffer(data)
+		require.NoError(t, err)
+		defer result.Close()
+
+		assert.Equal(t, 3, result.Bands())
+
+		// Подложка прижата к нижнему краю, верх изображения не тронут.
+		top, err := result.GetPoint(150, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []float64{0, 0, 0}, top)
+
+		left, _, width, height, err := result.FindTrim(1, &vips.Color{})
+		require.NoError(t, err)
+		assert.Greater(t, width, 100)
+		assert.Greater(t, height, 20)
+		assert.Greater(t, left, 0)
+	})
+
+	t.Run("markup is escaped", func(t *testing.T) {
+		img, err := NewImage(testJPEG(t, 300, 200))
+		require.NoError(t, err)
+
+		_, err = img.Process(&ImgData{Action: ImageActionCrop, Text: "<b>A & B</b>", TextStyle: "title"},
+			Options{TextStyles: styles})
+		assert.NoError(t, err)
+	})
+
+	t.Run("unknown style", func(t *testing.T) {
+		img, err := NewImage(testJPEG(t, 300, 200))
+		require.NoError(t, err)
+
+		_, err = img.Process(&ImgData{Action: ImageActionCrop, Text: "Привет", TextStyle: "missing"}, Options{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,255 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Position - расположение водяного знака или текста: по центру или у
+// края/угла.
+type Position string
+
+const (
+	PositionCentre    Position = "ce"
+	PositionNorth     Position = "no"
+	PositionSouth     Position = "so"
+	PositionEast      Position = "ea"
+	PositionWest      Position = "we"
+	PositionNorthEast Position = "noea"
+	PositionNorthWest Position = "nowe"
+	PositionSouthEast Position = "soea"
+	PositionSouthWest Position = "sowe"
+)
+
+// alignment - выравнивание по горизонтали и вертикали: -1 к началу, 0 по
+// центру, 1 к концу.
+type alignment struct {
+	x, y int
+}
+
+var positions = map[Position]alignment{
+	PositionCentre:    {0, 0},
+	PositionNorth:     {0, -1},
+	PositionSouth:     {0, 1},
+	PositionEast:      {1, 0},
+	PositionWest:      {-1, 0},
+	PositionNorthEast: {1, -1},
+	PositionNorthWest: {-1, -1},
+	PositionSouthEast: {1, 1},
+	PositionSouthWest: {-1, 1},
+}
+
+// ParsePosition разбирает расположение. Пустое значение означает центр.
+func ParsePosition(value string) (Position, error) {
+	if value == "" {
+		return PositionCentre, nil
+	}
+
+	position := Position(value)
+	if _, ok := positions[position]; !ok {
+		return "", fmt.Errorf("unsupported position: %q", value)
+	}
+	return position, nil
+}
+
+// WatermarkParams - параметры наложения водяного знака.
+type WatermarkParams struct {
+	Position Position
+	// OffsetX и OffsetY - отступ от края в пикселях. В режиме Tiled -
+	// промежуток между плитками.
+	OffsetX int
+	OffsetY int
+	// Opacity - непрозрачность от 0 до 1, нулевое значение означает 1.
+	Opacity float64
+	// Scale - ширина знака относительно ширины результата, нулевое значение
+	// сохраняет исходный размер.
+	Scale float64
+	// Tiled заполняет знаком всё изображение.
+	Tiled bool
+}
+
+// Watermark - водяной знак, загруженный при запуске.
+type Watermark struct {
+	data   []byte
+	params WatermarkParams
+}
+
+// LoadWatermark читает водяной знак с диска и проверяет параметры.
+func LoadWatermark(path string, params WatermarkParams) (*Watermark, error) {
+	position, err := ParsePosition(string(params.Position))
+	if err != nil {
+		return nil, err
+	}
+	params.Position = position
+
+	if params.Opacity < 0 || params.Opacity > 1 {
+		return nil, fmt.Errorf("opacity %g is out of range [0, 1]", params.Opacity)
+	}
+	if params.Scale < 0 || params.Scale > 1 {
+		return nil, fmt.Errorf("scale %g is out of range [0, 1]", params.Scale)
+	}
+	if params.OffsetX < 0 || params.OffsetY < 0 {
+		return nil, errors.New("offsets must not be negative")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watermark: %w", err)
+	}
+
+	img, err := vips.NewImageFromBuffer(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load watermark %s: %w", path, err)
+	}
+	img.Close()
+
+	return &Watermark{data: data, params: params}, nil
+}
+
+// watermark накладывает водяной знак name из реестра.
+func (i *Image) watermark(name string, watermarks map[string]*Watermark) error {
+	if name == "" {
+		return nil
+	}
+
+	wm, ok := watermarks[name]
+	if !ok {
+		return fmt.Errorf("unknown watermark: %q", name)
+	}
+
+	overlay, err := wm.overlay(i.VipsImg.Width(), i.VipsImg.PageHeight())
+	if err != nil {
+		return fmt.Errorf("failed to prepare watermark: %w", err)
+	}
+	defer overlay.Close()
+
+	if err := i.composite(overlay); err != nil {
+		return fmt.Errorf("failed to apply watermark: %w", err)
+	}
+
+	return nil
+}
+
+// composite накладывает прозрачный слой размером с кадр на каждый кадр
+// изображения.
+func (i *Image) composite(overlay *vips.ImageRef) error {
+	// Кадры анимации расположены друг под другом, слой нужен на каждом.
+	if pages := i.VipsImg.Height() / i.VipsImg.PageHeight(); pages > 1 {
+		if err := overlay.Replicate(1, pages); err != nil {
+			return err
+		}
+	}
+
+	hadAlpha := i.VipsImg.HasAlpha()
+	if err := i.VipsImg.Composite(overlay, vips.BlendModeOver, 0, 0); err != nil {
+		return err
+	}
+
+	// Composite всегда добавляет альфа-канал.
+	if !hadAlpha {
+		return i.VipsImg.ExtractBand(0, i.VipsImg.Bands()-1)
+	}
+
+	return nil
+}
+
+// overlay создаёт прозрачный слой размером width x height с водяным знаком.
+func (wm *Watermark) overlay(width, height int) (*vips.ImageRef, error) {
+	img, err := vips.NewImageFromBuffer(wm.data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := wm.prepare(img, width); err != nil {
+		img.Close()
+		return nil, err
+	}
+
+	if wm.params.Tiled {
+		err = wm.tile(img, width, height)
+	} else {
+		align := positions[wm.params.Position]
+		err = img.Embed(
+			alignOffset(align.x, width, img.Width(), wm.params.OffsetX),
+			alignOffset(align.y, height, img.Height(), wm.params.OffsetY),
+			width,
+			height,
+			vips.ExtendBlack,
+		)
+	}
+	if err != nil {
+		img.Close()
+		return nil, err
+	}
+
+	return img, nil
+}
+
+// prepare масштабирует знак и применяет прозрачность.
+func (wm *Watermark) prepare(img *vips.ImageRef, width int) error {
+	if err := img.ToColorSpace(vips.InterpretationSRGB); err != nil {
+		return err
+	}
+
+	if wm.params.Scale > 0 {
+		scale := wm.params.Scale * float64(width) / float64(img.Width())
+		if err := img.Resize(scale, vips.KernelLanczos3); err != nil {
+			return err
+		}
+	}
+
+	if err := img.AddAlpha(); err != nil {
+		return err
+	}
+
+	if wm.params.Opacity == 0 || wm.params.Opacity == 1 {
+		return nil
+	}
+
+	// Умножаем только альфа-канал.
+	a := make([]float64, img.Bands())
+	b := make([]float64, img.Bands())
+	for band := range a {
+		a[band] = 1
+	}
+	a[len(a)-1] = wm.params.Opacity
+
+	if err := img.Linear(a, b); err != nil {
+		return err
+	}
+	return img.Cast(vips.BandFormatUchar)
+}
+
+// tile заполняет область width x height плитками знака с промежутками
+// OffsetX и OffsetY.
+func (wm *Watermark) tile(img *vips.ImageRef, width, height int) error {
+	tileWidth, tileHeight := img.Width()+wm.params.OffsetX, img.Height()+wm.params.OffsetY
+	if err := img.Embed(0, 0, tileWidth, tileHeight, vips.ExtendBlack); err != nil {
+		return err
+	}
+
+	across := int(math.Ceil(float64(width) / float64(tileWidth)))
+	down := int(math.Ceil(float64(height) / float64(tileHeight)))
+	if err := img.Replicate(across, down); err != nil {
+		return err
+	}
+
+	return img.ExtractArea(0, 0, width, height)
+}
+
+// alignOffset возвращает смещение слоя размером inner внутри стороны outer.
+// Отступ считается от ближайшего края, при выравнивании по центру - от центра.
+func alignOffset(align, outer, inner, offset int) int {
+	switch align {
+	case -1:
+		return offset
+	case 1:
+		return outer - inner - offset
+	default:
+		return (outer-inner)/2 + offset
+	}
+}
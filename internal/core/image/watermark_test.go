@@ -0,0 +1,127 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlignOffset(t *testing.T) {
+	assert.Equal(t, 10, alignOffset(-1, 300, 100, 10))
+	assert.Equal(t, 190, alignOffset(1, 300, 100, 10))
+	assert.Equal(t, 100, alignOffset(0, 300, 100, 0))
+	assert.Equal(t, 110, alignOffset(0, 300, 100, 10))
+}
+
+func TestLoadWatermark(t *testing.T) {
+	path := testWatermark(t, 20, 20)
+
+	t.Run("default position", func(t *testing.T) {
+		wm, err := LoadWatermark(path, WatermarkParams{})
+		require.NoError(t, err)
+		assert.Equal(t, PositionCentre, wm.params.Position)
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		_, err := LoadWatermark(path, WatermarkParams{Position: "top"})
+		assert.Error(t, err)
+
+		_, err = LoadWatermark(path, WatermarkParams{Opacity: 1.5})
+		assert.Error(t, err)
+
+		_, err = LoadWatermark(path, WatermarkParams{Scale: -0.1})
+		assert.Error(t, err)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadWatermark(filepath.Join(t.TempDir(), "missing.png"), WatermarkParams{})
+		assert.Error(t, err)
+	})
+}
+
+func TestProcessWatermark(t *testing.T) {
+	path := testWatermark(t, 20, 20)
+
+	tests := []struct {
+		name   string
+		params WatermarkParams
+		// marked - точка, покрытая знаком, clean - точка без знака.
+		marked, clean [2]int
+	}{
+		{
+			name:   "south east",
+			params: WatermarkParams{Position: PositionSouthEast, OffsetX: 5, OffsetY: 5},
+			marked: [2]int{85, 85}, clean: [2]int{10, 10},
+		},
+		{
+			name:   "scale",
+			params: WatermarkParams{Position: PositionNorthWest, Scale: 0.5},
+			marked: [2]int{45, 45}, clean: [2]int{55, 55},
+		},
+		{
+			name:   "tiled",
+			params: WatermarkParams{Tiled: true, OffsetX: 20, OffsetY: 20},
+			marked: [2]int{50, 50}, clean: [2]int{30, 30},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wm, err := LoadWatermark(path, tt.params)
+			require.NoError(t, err)
+
+			img, err := NewImage(testJPEG(t, 100, 100))
+			require.NoError(t, err)
+
+			data, err := img.Process(&ImgData{Action: ImageActionCrop, Format: vips.ImageTypePNG, Watermark: "stock"},
+				Options{Watermarks: map[string]*Watermark{"stock": wm}})
+			require.NoError(t, err)
+
+			result, err := vips.NewImageFromBuffer(data)
+			require.NoError(t, err)
+			defer result.Close()
+
+			assert.False(t, result.HasAlpha())
+
+			marked, err := result.GetPoint(tt.marked[0], tt.marked[1])
+			require.NoError(t, err)
+			assert.Greater(t, marked[0], 200.0)
+
+			clean, err := result.GetPoint(tt.clean[0], tt.clean[1])
+			require.NoError(t, err)
+			assert.Less(t, clean[0], 10.0)
+		})
+	}
+
+	t.Run("unknown watermark", func(t *testing.T) {
+		img, err := NewImage(testJPEG(t, 100, 100))
+		require.NoError(t, err)
+
+		_, err = img.Process(&ImgData{Action: ImageActionCrop, Watermark: "missing"}, Options{})
+		assert.Error(t, err)
+	})
+}
+
+// testWatermark сохраняет белый прямоугольник width x height и возвращает путь к нему.
+func testWatermark(t *testing.T, width, height int) string {
+	t.Helper()
+
+	img, err := vips.Black(width, height)
+	require.NoError(t, err)
+	defer img.Close()
+
+	require.NoError(t, img.Linear1(1, 255))
+	require.NoError(t, img.Cast(vips.BandFormatUchar))
+
+	data, _, err := img.ExportPng(vips.NewPngExportParams())
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "watermark.png")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	return path
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxBatchVariants - максимальное число вариантов в одном запросе /batch.
+const maxBatchVariants = 32
+
+// batchRequest - тело запроса /batch: один исходник и список вариантов.
+type batchRequest struct {
+	URL      string         `json:"url"`
+	Variants []batchVariant `json:"variants"`
+}
+
+// batchVariant - параметры одного варианта. Поля соответствуют параметрам
+// /resize, нулевые значения не передаются.
+type batchVariant struct {
+	Mode    string  `json:"mode"`
+	Width   int     `json:"width"`
+	Height  int     `json:"height"`
+	Format  string  `json:"format"`
+	Quality int     `json:"quality"`
+	Gravity string  `json:"gravity"`
+	DPR     float64 `json:"dpr"`
+	Ops     string  `json:"ops"`
+}
+
+// batchResult - результат обработки варианта. URL ведёт на /resize с теми же
+// параметрами, поэтому запрос по нему попадает в кэш.
+type batchResult struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	Bytes  int    `json:"bytes,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// batchItem - разобранный вариант и его URL.
+type batchItem struct {
+	request *ImageRequest
+	url     string
+}
+
+// parseBatch разбирает тело запроса /batch. Каждый вариант переводится в
+// query-строку /resize и проверяется так же, как обычный запрос, поэтому
+// вариант сохраняется в кэше под тем же ключом.
+func parseBatch(body io.Reader, limits OutputLimits, defaults optionDefaults) ([]batchItem, error) {
+	var req batchRequest
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		return nil, fmt.Errorf("invalid batch request: %w", err)
+	}
+
+	if req.URL == "" {
+		return nil, errors.New("missing url")
+	}
+	if len(req.Variants) == 0 || len(req.Variants) > maxBatchVariants {
+		return nil, fmt.Errorf("batch must contain from 1 to %d variants, got %d", maxBatchVariants, len(req.Variants))
+	}
+
+	items := make([]batchItem, 0, len(req.Variants))
+	for i, variant := range req.Variants {
+		query := variant.query(req.URL)
+
+		imageRequest := newImageRequest(defaults)
+		err := imageRequest.validateQuery(query, limits)
+		if err == nil {
+			err = imageRequest.parseOptions(query, http.Header{}, defaults)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid variant %d: %w", i, err)
+		}
+
+		items = append(items, batchItem{request: imageRequest, url: "/resize?" + query.Encode()})
+	}
+
+	return items, nil
+}
+
+func (v batchVariant) query(sourceURL string) url.Values {
+	query := url.Values{"url": {sourceURL}}
+
+	set := func(name, value string) {
+		if value != "" && value != "0" {
+			query.Set(name, value)
+		}
+	}
+	set("mode", v.Mode)
+	set("w", strconv.Itoa(v.Width))
+	set("h", strconv.Itoa(v.Height))
+	set("format", v.Format)
+	set("q", strconv.Itoa(v.Quality))
+	set("g", v.Gravity)
+	set("dpr", strconv.FormatFloat(v.DPR, 'f', -1, 64))
+	set("ops", v.Ops)
+
+	return query
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBatch(t *testing.T) {
+	limits := OutputLimits{MaxWidth: 2000, MaxHeight: 2000}
+	defaults := optionDefaults{Enlarge: true}
+
+	t.Run("variants", func(t *testing.T) {
+		body := `{
+			"url": "https://example.com/a.jpg?v=2",
+			"variants": [
+				{"width": 320, "format": "webp", "quality": 80},
+				{"width": 640, "height": 480, "mode": "fill", "gravity": "sm", "dpr": 2, "ops": "sh:0.5"}
+			]
+		}`
+
+		items, err := parseBatch(strings.NewReader(body), limits, defaults)
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+
+		first := items[0].request
+		assert.Equal(t, "https://example.com/a.jpg?v=2", first.ImageURL)
+		assert.Equal(t, 320, first.Width)
+		assert.Equal(t, vips.ImageTypeWEBP, first.Format)
+		assert.Equal(t, 80, first.Quality)
+		assert.Equal(t, 1.0, first.DPR)
+		assert.True(t, first.Enlarge)
+
+		second := items[1].request
+		assert.Equal(t, 480, second.Height)
+		assert.Equal(t, 2.0, second.DPR)
+		require.Len(t, second.Steps, 1)
+		assert.Equal(t, "sharpen:0.5", second.Steps[0].String())
+	})
+
+	t.Run("url matches resize request", func(t *testing.T) {
+		body := `{"url": "https://example.com/a.jpg", "variants": [{"width": 320, "format": "avif", "ops": "bl:2"}]}`
+
+		items, err := parseBatch(strings.NewReader(body), limits, defaults)
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+
+		link, err := url.Parse(items[0].url)
+		require.NoError(t, err)
+		assert.Equal(t, "/resize", link.Path)
+
+		req := newImageRequest(defaults)
+		require.NoError(t, req.validateQuery(link.Query(), limits))
+		require.NoError(t, req.parseOptions(link.Query(), http.Header{}, defaults))
+		assert.Equal(t, items[0].request, req)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, body := range []string{
+			`not json`,
+			`{"variants": [{"width": 100}]}`,
+			`{"url": "https://example.com/a.jpg", "variants": []}`,
+			`{"url": "https://example.com/a.jpg", "variants": [{"width": 5000}]}`,
+			`{"url": "https://example.com/a.jpg", "variants": [{"width": 100, "format": "bmp"}]}`,
+			`{"url": "https://example.com/a.jpg", "variants": [{"width": 100, "mode": "crop"}]}`,
+			`{"url": "https://example.com/a.jpg", "variants": [{}]}`,
+		} {
+			_, err := parseBatch(strings.NewReader(body), limits, defaults)
+			assert.Error(t, err, body)
+		}
+
+		variants := strings.Repeat(`{"width": 100},`, maxBatchVariants)
+		body := `{"url": "https://example.com/a.jpg", "variants": [` + variants + `{"width": 100}]}`
+		_, err := parseBatch(strings.NewReader(body), limits, defaults)
+		assert.Error(t, err)
+	})
+}
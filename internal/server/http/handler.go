@@ -2,18 +2,31 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
 
 	"github.com/IKolyas/thumbnailer/internal/core/image"
 	"github.com/IKolyas/thumbnailer/internal/storage/source"
-	"github.com/davidbyttow/govips/v2/vips"
 )
 
 const (
 	headerContentLength = "Content-Length"
+	headerContentType   = "Content-Type"
+	headerImageWidth    = "X-Image-Width"
+	headerImageHeight   = "X-Image-Height"
+	headerContentDPR    = "Content-DPR"
+	headerVary          = "Vary"
 	headerContextKey    = "Headers"
+
+	contentTypeText = "text/plain; charset=utf-8"
+	contentTypeJSON = "application/json"
 )
 
 type PreviewerHandler struct {
@@ -27,44 +40,262 @@ func NewPreviewerHandler(server Server) *PreviewerHandler {
 }
 
 func (ph *PreviewerHandler) Fill(w http.ResponseWriter, r *http.Request) {
-	ctx := ph.prepareContext(r)
 	imageRequest, err := ph.parseAndValidateRequest(r)
 	if err != nil {
 		ph.handleError(w, "Failed to parse parameters from path", err, http.StatusBadRequest)
 		return
 	}
 
-	imgData := ph.createImageData(imageRequest)
+	ph.serveImage(w, r, imageRequest, r.URL.Query())
+}
+
+func (ph *PreviewerHandler) Resize(w http.ResponseWriter, r *http.Request) {
+	imageRequest := newImageRequest(ph.server.defaults)
+	if err := imageRequest.validateQuery(r.URL.Query(), ph.server.limits); err != nil {
+		ph.handleError(w, "Failed to parse query parameters", err, http.StatusBadRequest)
+		return
+	}
+
+	ph.serveImage(w, r, imageRequest, r.URL.Query())
+}
+
+func (ph *PreviewerHandler) Process(w http.ResponseWriter, r *http.Request) {
+	imageRequest := newImageRequest(ph.server.defaults)
+	if err := imageRequest.validateOptions(r.URL.Path, ph.server.limits, ph.server.defaults); err != nil {
+		ph.handleError(w, "Failed to parse processing options", err, http.StatusBadRequest)
+		return
+	}
+
+	ph.serveImage(w, r, imageRequest, r.URL.Query())
+}
+
+func (ph *PreviewerHandler) Crop(w http.ResponseWriter, r *http.Request) {
+	imageRequest := newImageRequest(ph.server.defaults)
+	if err := imageRequest.validateCrop(r.URL.Path); err != nil {
+		ph.handleError(w, "Failed to parse parameters from path", err, http.StatusBadRequest)
+		return
+	}
+
+	ph.serveImage(w, r, imageRequest, r.URL.Query())
+}
+
+func (ph *PreviewerHandler) Preset(w http.ResponseWriter, r *http.Request) {
+	imageRequest := newImageRequest(ph.server.defaults)
+	if err := imageRequest.validatePreset(r.URL.Path, ph.server.presets); err != nil {
+		ph.handleError(w, "Failed to parse parameters from path", err, http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	if ph.server.presetsOnly {
+		query = presetQuery(query)
+	}
+
+	ph.serveImage(w, r, imageRequest, query)
+}
+
+func (ph *PreviewerHandler) BlurHash(w http.ResponseWriter, r *http.Request) {
+	imageRequest := newImageRequest(ph.server.defaults)
+	if err := imageRequest.validateBlurHash(r.URL.Path); err != nil {
+		ph.handleError(w, "Failed to parse parameters from path", err, http.StatusBadRequest)
+		return
+	}
+
+	ph.serveText(w, r, imageRequest, contentTypeText)
+}
+
+func (ph *PreviewerHandler) LQIP(w http.ResponseWriter, r *http.Request) {
+	imageRequest := newImageRequest(ph.server.defaults)
+	if err := imageRequest.validateLQIP(r.URL.Path); err != nil {
+		ph.handleError(w, "Failed to parse parameters from path", err, http.StatusBadRequest)
+		return
+	}
+
+	ph.serveText(w, r, imageRequest, contentTypeText)
+}
+
+// Info отдаёт сведения об исходном изображении в JSON.
+func (ph *PreviewerHandler) Info(w http.ResponseWriter, r *http.Request) {
+	imageRequest := newImageRequest(ph.server.defaults)
+	if err := imageRequest.validateInfo(r.URL.Path, r.URL.Query()); err != nil {
+		ph.handleError(w, "Failed to parse parameters from path", err, http.StatusBadRequest)
+		return
+	}
+
+	ph.serveText(w, r, imageRequest, contentTypeJSON)
+}
+
+// serveText отдаёт текстовый результат: плейсхолдер или сведения об
+// изображении. Такие результаты кэшируются так же, как изображения.
+func (ph *PreviewerHandler) serveText(w http.ResponseWriter, r *http.Request, req *ImageRequest, contentType string) {
+	ctx := ph.prepareContext(r)
+	body, err := ph.server.storage.Get(ctx, &image.ImgData{
+		ImageURL: req.ImageURL,
+		Width:    req.Width,
+		Action:   req.Mode,
+		Colors:   req.Colors,
+	})
+	if err != nil {
+		ph.handleStorageError(w, err)
+		return
+	}
+
+	w.Header().Set(headerContentType, contentType)
+	w.Header().Set(headerContentLength, fmt.Sprint(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		ph.server.logger.Error(fmt.Sprintf("Failed to write response: %v", err))
+	}
+}
+
+// Batch обрабатывает несколько вариантов одного исходника. Исходник
+// скачивается один раз, варианты обрабатываются параллельно и сохраняются в
+// кэше под теми же ключами, что и при запросе через /resize.
+func (ph *PreviewerHandler) Batch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		err := fmt.Errorf("method %s is not allowed", r.Method)
+		ph.handleError(w, "Failed to parse batch request", err, http.StatusMethodNotAllowed)
+		return
+	}
+
+	items, err := parseBatch(r.Body, ph.server.limits, ph.server.defaults)
+	if err != nil {
+		ph.handleError(w, "Failed to parse batch request", err, http.StatusBadRequest)
+		return
+	}
+
+	ctx := source.WithSharedDownload(ph.prepareContext(r))
+	results := make([]batchResult, len(items))
+	errs := make([]error, len(items))
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, ph.server.batchConcurrency)
+	for i, item := range items {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			results[i], errs[i] = ph.renderVariant(ctx, item)
+		}()
+	}
+	wg.Wait()
+
+	// Если не удался ни один вариант, скорее всего недоступен сам исходник.
+	if !slices.Contains(errs, nil) {
+		ph.handleStorageError(w, errs[0])
+		return
+	}
+
+	body, err := json.Marshal(map[string][]batchResult{"variants": results})
+	if err != nil {
+		ph.handleError(w, "Failed to encode batch response", err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set(headerContentType, contentTypeJSON)
+	w.Header().Set(headerContentLength, fmt.Sprint(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(body); err != nil {
+		ph.server.logger.Error(fmt.Sprintf("Failed to write response: %v", err))
+	}
+}
+
+func (ph *PreviewerHandler) renderVariant(ctx context.Context, item batchItem) (batchResult, error) {
+	result := batchResult{URL: item.url}
+
+	data, err := ph.server.storage.Get(ctx, ph.createImageData(item.request))
+	if err != nil {
+		ph.server.logger.Error(fmt.Sprintf("Failed to render batch variant %s: %v", item.url, err))
+		result.Error = err.Error()
+		return result, err
+	}
+
+	if width, height, err := image.Size(data); err == nil {
+		result.Width, result.Height = width, height
+	}
+	result.Bytes = len(data)
+
+	return result, nil
+}
+
+// serveImage разбирает необязательные параметры query и отдаёт результат
+// обработки.
+func (ph *PreviewerHandler) serveImage(w http.ResponseWriter, r *http.Request, req *ImageRequest, query url.Values) {
+	if err := req.parseOptions(query, r.Header, ph.server.defaults); err != nil {
+		ph.handleError(w, "Failed to parse query parameters", err, http.StatusBadRequest)
+		return
+	}
+
+	ctx := ph.prepareContext(r)
+	imgData := ph.createImageData(req)
 	imageData, err := ph.server.storage.Get(ctx, imgData)
 	if err != nil {
 		ph.handleStorageError(w, err)
 		return
 	}
 
+	if width, height, err := image.Size(imageData); err == nil {
+		w.Header().Set(headerImageWidth, strconv.Itoa(width))
+		w.Header().Set(headerImageHeight, strconv.Itoa(height))
+		w.Header().Set(headerContentDPR, strconv.FormatFloat(contentDPR(req, width, height), 'f', -1, 64))
+	}
+	w.Header().Add(headerVary, "Sec-CH-DPR, DPR")
 	ph.writeResponse(w, imageData)
 }
 
+// contentDPR возвращает DPR, с которым отдан результат. Без увеличения
+// результат ограничен размерами исходника и может быть меньше запрошенного,
+// поэтому DPR считается по фактическому размеру, а не берётся из запроса.
+// Если размер не запрошен, изображение отдаётся в своём размере.
+func contentDPR(req *ImageRequest, width, height int) float64 {
+	var dpr float64
+	switch {
+	case req.Width > 0:
+		dpr = float64(width) / float64(req.Width)
+	case req.Height > 0:
+		dpr = float64(height) / float64(req.Height)
+	default:
+		return 1
+	}
+	return math.Round(dpr*100) / 100
+}
+
 func (ph *PreviewerHandler) prepareContext(r *http.Request) context.Context {
 	ctx := r.Context()
 	//nolint
 	return context.WithValue(ctx, headerContextKey, r.Header)
 }
 
-func (ph *PreviewerHandler) parseAndValidateRequest(r *http.Request) (*FillImageRequest, error) {
-	imageRequest := &FillImageRequest{}
-	if err := imageRequest.validate(r.URL.Path); err != nil {
+func (ph *PreviewerHandler) parseAndValidateRequest(r *http.Request) (*ImageRequest, error) {
+	imageRequest := newImageRequest(ph.server.defaults)
+	if err := imageRequest.validate(r.URL.Path, ph.server.limits); err != nil {
 		return nil, err
 	}
 	return imageRequest, nil
 }
 
-func (ph *PreviewerHandler) createImageData(req *FillImageRequest) *image.ImgData {
+func (ph *PreviewerHandler) createImageData(req *ImageRequest) *image.ImgData {
 	return &image.ImgData{
-		ImageURL: req.ImageURL,
-		Width:    req.Width,
-		Height:   req.Height,
-		Format:   vips.ImageTypeUnknown,
-		Action:   image.ImageActionFill,
+		ImageURL:      req.ImageURL,
+		Width:         scaleDPR(req.Width, req.DPR),
+		Height:        scaleDPR(req.Height, req.DPR),
+		Format:        req.Format,
+		Action:        req.Mode,
+		Gravity:       req.Gravity,
+		FocalPoint:    req.FocalPoint,
+		Enlarge:       req.Enlarge,
+		DPR:           req.DPR,
+		Quality:       req.Quality,
+		Steps:         req.Steps,
+		Frame:         req.Frame,
+		Watermark:     req.Watermark,
+		Text:          req.Text,
+		TextStyle:     req.TextStyle,
+		KeepICC:       req.KeepICC,
+		KeepCopyright: req.KeepCopyright,
 	}
 }
 
@@ -84,9 +315,14 @@ func (ph *PreviewerHandler) handleStorageError(w http.ResponseWriter, err error)
 }
 
 func (ph *PreviewerHandler) writeResponse(w http.ResponseWriter, imageData []byte) {
+	w.Header().Set(headerContentType, image.ContentType(imageData))
 	w.Header().Set(headerContentLength, fmt.Sprint(len(imageData)))
 	w.WriteHeader(http.StatusOK)
 	if _, err := w.Write(imageData); err != nil {
 		ph.server.logger.Error(fmt.Sprintf("Failed to write response: %v", err))
 	}
 }
+
+func scaleDPR(side int, dpr float64) int {
+	return int(math.Round(float64(side) * dpr))
+}
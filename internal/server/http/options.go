@@ -0,0 +1,284 @@
+package http
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/IKolyas/thumbnailer/internal/core/image"
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+const (
+	// plainPrefix отмечает URL источника в открытом виде.
+	plainPrefix = "plain/"
+	// optionSeparator разделяет имя опции и её аргументы.
+	optionSeparator = ":"
+)
+
+// optionParser применяет аргументы опции к запросу.
+type optionParser func(f *ImageRequest, args []string, defaults optionDefaults) error
+
+// processingOptions - опции пути вида /rs:fill:300:200/g:sm/q:80/f:webp/plain/{url}.
+// У каждой опции есть полное и короткое имя. Опции, которых нет в списке,
+// разбираются как шаги конвейера обработки (image.ParseOperation).
+var processingOptions = map[string]optionParser{
+	"resize":    parseResizeOption,
+	"rs":        parseResizeOption,
+	"width":     parseWidthOption,
+	"w":         parseWidthOption,
+	"height":    parseHeightOption,
+	"h":         parseHeightOption,
+	"gravity":   parseGravityOption,
+	"g":         parseGravityOption,
+	"fp":        parseFocalPointOption,
+	"quality":   singleArg((*ImageRequest).setQuality),
+	"q":         singleArg((*ImageRequest).setQuality),
+	"format":    singleArg((*ImageRequest).setFormat),
+	"f":         singleArg((*ImageRequest).setFormat),
+	"ext":       singleArg((*ImageRequest).setFormat),
+	"enlarge":   parseEnlargeOption,
+	"el":        parseEnlargeOption,
+	"dpr":       parseDPROption,
+	"keep":      parseKeepOption,
+	"frame":     singleArg((*ImageRequest).setFrame),
+	"watermark": parseWatermarkOption,
+	"wm":        parseWatermarkOption,
+	"text":      parseTextOption,
+	"txt":       parseTextOption,
+}
+
+// validateOptions разбирает путь из опций обработки. Порядок опций не
+// влияет на результат: все они сводятся к одной модели ImageRequest, из
+// которой строится канонический ключ кэша.
+func (f *ImageRequest) validateOptions(urlPath string, limits OutputLimits, defaults optionDefaults) error {
+	rest := strings.TrimPrefix(urlPath, "/")
+
+	for rest != "" {
+		if strings.HasPrefix(rest, plainPrefix) || strings.HasPrefix(rest, encodedPrefix) {
+			return f.setSource(rest, limits)
+		}
+
+		segment, tail, _ := strings.Cut(rest, "/")
+		if err := f.applyOption(segment, defaults); err != nil {
+			return fmt.Errorf("invalid option %q: %w", segment, err)
+		}
+		rest = tail
+	}
+
+	return errors.New("missing source URL: expected plain/{url} or enc/{base64url}")
+}
+
+func (f *ImageRequest) applyOption(segment string, defaults optionDefaults) error {
+	name, args := splitOption(segment)
+
+	if parse, ok := processingOptions[name]; ok {
+		return parse(f, args, defaults)
+	}
+
+	// Остальные опции - шаги конвейера обработки в порядке их указания.
+	return f.addStep(name, args)
+}
+
+func (f *ImageRequest) addStep(name string, args []string) error {
+	op, err := image.ParseOperation(name, args)
+	if err != nil {
+		return err
+	}
+	f.Steps = append(f.Steps, op)
+	return nil
+}
+
+// setSteps добавляет шаги из списка вида rot:90,bl:2.
+func (f *ImageRequest) setSteps(value string) error {
+	steps, err := image.ParseSteps(value)
+	if err != nil {
+		return err
+	}
+	f.Steps = append(f.Steps, steps...)
+	return nil
+}
+
+func (f *ImageRequest) setSource(rest string, limits OutputLimits) error {
+	if err := limits.check(f.Width, f.Height); err != nil {
+		return err
+	}
+
+	if plain, ok := strings.CutPrefix(rest, plainPrefix); ok {
+		if plain == "" {
+			return errors.New("empty source URL")
+		}
+		imageURL, err := canonicalURL(plain)
+		if err != nil {
+			return err
+		}
+		f.ImageURL = imageURL
+		return nil
+	}
+
+	imageURL, format, err := sourceURL(rest)
+	if err != nil {
+		return err
+	}
+
+	f.ImageURL = imageURL
+	if format != vips.ImageTypeUnknown {
+		f.Format = format
+	}
+
+	return nil
+}
+
+// splitOption делит опцию вида имя:арг1:арг2 на имя и аргументы.
+func splitOption(option string) (string, []string) {
+	name, rawArgs, _ := strings.Cut(option, optionSeparator)
+	if rawArgs == "" {
+		return name, nil
+	}
+	return name, strings.Split(rawArgs, optionSeparator)
+}
+
+// parseResizeOption разбирает rs:{mode}:{width}:{height}[:{enlarge}].
+// Пустые аргументы оставляют текущие значения.
+func parseResizeOption(f *ImageRequest, args []string, _ optionDefaults) error {
+	if len(args) == 0 || len(args) > 4 {
+		return errors.New("expected rs:{mode}:{width}:{height}[:{enlarge}]")
+	}
+
+	if args[0] != "" {
+		mode := image.Action(args[0])
+		if mode != image.ImageActionFill {
+			return fmt.Errorf("unsupported mode: %q", mode)
+		}
+		f.Mode = mode
+	}
+
+	setters := []optionParser{
+		parseWidthOption, parseHeightOption, parseEnlargeOption,
+	}
+	for i, arg := range args[1:] {
+		if arg == "" {
+			continue
+		}
+		if err := setters[i](f, []string{arg}, optionDefaults{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseWidthOption(f *ImageRequest, args []string, _ optionDefaults) error {
+	width, err := sizeArg(args)
+	if err != nil {
+		return fmt.Errorf("invalid width: %w", err)
+	}
+	f.Width = width
+	return nil
+}
+
+func parseHeightOption(f *ImageRequest, args []string, _ optionDefaults) error {
+	height, err := sizeArg(args)
+	if err != nil {
+		return fmt.Errorf("invalid height: %w", err)
+	}
+	f.Height = height
+	return nil
+}
+
+// parseGravityOption разбирает g:{gravity} и g:fp:{x}:{y}.
+func parseGravityOption(f *ImageRequest, args []string, defaults optionDefaults) error {
+	if len(args) > 0 && args[0] == string(image.GravityFocalPoint) {
+		return parseFocalPointOption(f, args[1:], defaults)
+	}
+	return singleArg((*ImageRequest).setGravity)(f, args, defaults)
+}
+
+// parseFocalPointOption разбирает fp:{x}:{y}.
+func parseFocalPointOption(f *ImageRequest, args []string, _ optionDefaults) error {
+	if len(args) != 2 {
+		return errors.New("expected fp:{x}:{y}")
+	}
+	return f.setFocalPoint(args[0] + "," + args[1])
+}
+
+func parseWatermarkOption(f *ImageRequest, args []string, defaults optionDefaults) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one argument")
+	}
+	return f.setWatermark(args[0], defaults.Watermarks)
+}
+
+// parseTextOption разбирает txt:{base64url}[:{style}]. Текст кодируется
+// base64url, чтобы в нём могли быть символы / и :.
+func parseTextOption(f *ImageRequest, args []string, defaults optionDefaults) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("expected txt:{base64url}[:{style}]")
+	}
+
+	text, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(args[0], "="))
+	if err != nil {
+		return fmt.Errorf("invalid base64url text: %w", err)
+	}
+
+	var style string
+	if len(args) == 2 {
+		style = args[1]
+	}
+
+	return f.setText(string(text), style, defaults.TextStyles)
+}
+
+// parseKeepOption разбирает keep:icc:copyright.
+func parseKeepOption(f *ImageRequest, args []string, _ optionDefaults) error {
+	if len(args) == 0 {
+		return errors.New("expected at least one argument")
+	}
+	return f.setKeep(args...)
+}
+
+func parseEnlargeOption(f *ImageRequest, args []string, defaults optionDefaults) error {
+	if err := singleArg((*ImageRequest).setEnlarge)(f, args, defaults); err != nil {
+		return err
+	}
+	f.pathEnlarge = true
+	return nil
+}
+
+func parseDPROption(f *ImageRequest, args []string, defaults optionDefaults) error {
+	if len(args) != 1 {
+		return errors.New("expected exactly one argument")
+	}
+	if err := f.setDPR(args[0], defaults.maxDPR()); err != nil {
+		return err
+	}
+	f.pathDPR = true
+	return nil
+}
+
+func singleArg(set func(f *ImageRequest, value string) error) optionParser {
+	return func(f *ImageRequest, args []string, _ optionDefaults) error {
+		if len(args) != 1 {
+			return errors.New("expected exactly one argument")
+		}
+		return set(f, args[0])
+	}
+}
+
+func sizeArg(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.New("expected exactly one argument")
+	}
+
+	size, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, err
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("negative value: %d", size)
+	}
+
+	return size, nil
+}
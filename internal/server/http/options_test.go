@@ -0,0 +1,192 @@
+package http
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/IKolyas/thumbnailer/internal/core/image"
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateOptions(t *testing.T) {
+	limits := OutputLimits{MaxWidth: 1000, MaxHeight: 1000}
+	defaults := optionDefaults{}
+
+	t.Run("full options", func(t *testing.T) {
+		req := newImageRequest(defaults)
+		err := req.validateOptions("/rs:fill:300:200/g:sm/q:80/f:webp/plain/https:/example.com/image.jpg", limits, defaults)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/image.jpg", req.ImageURL)
+		assert.Equal(t, image.ImageActionFill, req.Mode)
+		assert.Equal(t, 300, req.Width)
+		assert.Equal(t, 200, req.Height)
+		assert.Equal(t, image.GravitySmart, req.Gravity)
+		assert.Equal(t, 80, req.Quality)
+		assert.Equal(t, vips.ImageTypeWEBP, req.Format)
+	})
+
+	t.Run("order does not matter", func(t *testing.T) {
+		first := newImageRequest(defaults)
+		assert.NoError(t, first.validateOptions("/rs:fill:300:200/q:80/f:webp/plain/example.com/a.jpg", limits, defaults))
+
+		second := newImageRequest(defaults)
+		path := "/format:webp/quality:80/w:300/h:200/plain/example.com/a.jpg"
+		assert.NoError(t, second.validateOptions(path, limits, defaults))
+
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("encoded source", func(t *testing.T) {
+		encoded := base64.RawURLEncoding.EncodeToString([]byte("https://example.com/a.jpg?v=1"))
+		req := newImageRequest(defaults)
+		assert.NoError(t, req.validateOptions("/w:300/enc/"+encoded+".png", limits, defaults))
+		assert.Equal(t, "https://example.com/a.jpg?v=1", req.ImageURL)
+		assert.Equal(t, vips.ImageTypePNG, req.Format)
+	})
+
+	t.Run("keep metadata", func(t *testing.T) {
+		req := newImageRequest(defaults)
+		assert.NoError(t, req.validateOptions("/w:300/keep:icc:copyright/plain/example.com/a.jpg", limits, defaults))
+		assert.True(t, req.KeepICC)
+		assert.True(t, req.KeepCopyright)
+
+		req = newImageRequest(defaults)
+		assert.ErrorContains(t, req.validateOptions("/keep:gps/plain/example.com/a.jpg", limits, defaults), `"keep:gps"`)
+	})
+
+	t.Run("frame", func(t *testing.T) {
+		req := newImageRequest(defaults)
+		assert.NoError(t, req.validateOptions("/w:300/frame:3/plain/example.com/a.gif", limits, defaults))
+		assert.Equal(t, 3, req.Frame)
+	})
+
+	t.Run("watermark", func(t *testing.T) {
+		defaults := optionDefaults{Watermarks: []string{"stock"}}
+		req := newImageRequest(defaults)
+		assert.NoError(t, req.validateOptions("/w:300/wm:stock/plain/example.com/a.jpg", limits, defaults))
+		assert.Equal(t, "stock", req.Watermark)
+
+		req = newImageRequest(defaults)
+		err := req.validateOptions("/watermark:other/plain/example.com/a.jpg", limits, defaults)
+		assert.ErrorContains(t, err, `"watermark:other"`)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		defaults := optionDefaults{TextStyles: []string{"default", "title"}}
+		encoded := base64.RawURLEncoding.EncodeToString([]byte("Скидки 50%: сегодня/завтра"))
+
+		req := newImageRequest(defaults)
+		assert.NoError(t, req.validateOptions("/w:300/txt:"+encoded+":title/plain/example.com/a.jpg", limits, defaults))
+		assert.Equal(t, "Скидки 50%: сегодня/завтра", req.Text)
+		assert.Equal(t, "title", req.TextStyle)
+
+		req = newImageRequest(defaults)
+		assert.NoError(t, req.validateOptions("/w:300/txt:"+encoded+"/plain/example.com/a.jpg", limits, defaults))
+		assert.Equal(t, "default", req.TextStyle)
+
+		req = newImageRequest(defaults)
+		assert.Error(t, req.validateOptions("/w:300/txt:!!!/plain/example.com/a.jpg", limits, defaults))
+	})
+
+	t.Run("path options override defaults", func(t *testing.T) {
+		defaults := optionDefaults{Enlarge: true}
+		req := newImageRequest(defaults)
+		assert.NoError(t, req.validateOptions("/w:300/el:0/dpr:2/plain/example.com/a.jpg", limits, defaults))
+
+		header := http.Header{"Dpr": {"3"}}
+		for range 2 {
+			assert.NoError(t, req.parseOptions(url.Values{}, header, defaults))
+			assert.False(t, req.Enlarge)
+			assert.Equal(t, 2.0, req.DPR)
+		}
+	})
+
+	t.Run("errors name the bad option", func(t *testing.T) {
+		req := newImageRequest(defaults)
+		err := req.validateOptions("/rs:fill:300:200/q:500/plain/example.com/a.jpg", limits, defaults)
+		assert.ErrorContains(t, err, `"q:500"`)
+
+		err = req.validateOptions("/rs:fill:300:200/foo:1/plain/example.com/a.jpg", limits, defaults)
+		assert.ErrorContains(t, err, `"foo:1"`)
+
+		err = req.validateOptions("/rs:fit:300:200/plain/example.com/a.jpg", limits, defaults)
+		assert.ErrorContains(t, err, `"rs:fit:300:200"`)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		req := newImageRequest(defaults)
+		assert.Error(t, req.validateOptions("/rs:fill:300:200", limits, defaults))
+		assert.Error(t, req.validateOptions("/rs:fill:5000:200/plain/example.com/a.jpg", limits, defaults))
+		assert.Error(t, req.validateOptions("/q:80/plain/example.com/a.jpg", limits, defaults))
+		assert.Error(t, req.validateOptions("/w:300/dpr:NaN/plain/example.com/a.jpg", limits, defaults))
+	})
+}
+
+func TestValidateOptionsSteps(t *testing.T) {
+	limits := OutputLimits{}
+	defaults := optionDefaults{}
+
+	req := newImageRequest(defaults)
+	err := req.validateOptions("/rs:fill:300:200/bl:2/rot:90/fl:h/plain/example.com/a.jpg", limits, defaults)
+	assert.NoError(t, err)
+	require.Len(t, req.Steps, 3)
+	assert.Equal(t, "blur:2", req.Steps[0].String())
+	assert.Equal(t, "rotate:90", req.Steps[1].String())
+	assert.Equal(t, "flip:h", req.Steps[2].String())
+
+	// Шаги не переставляются: поворот после размытия выполнился бы до
+	// ресайза, поэтому такой порядок отклоняется.
+	assert.ErrorContains(t, req.parseOptions(url.Values{}, http.Header{}, defaults), "rotate:90 must come before blur:2")
+
+	for ops, valid := range map[string]bool{"bl:2": true, "fl:h,bl:2": true, "bl:2,fl:h": false} {
+		withQuery := newImageRequest(defaults)
+		require.NoError(t, withQuery.validateOptions("/rs:fill:300:200/rot:90/plain/example.com/a.jpg", limits, defaults))
+		err := withQuery.parseOptions(url.Values{"ops": {ops}}, http.Header{}, defaults)
+		assert.Equal(t, valid, err == nil, ops)
+	}
+
+	err = req.validateOptions("/rs:fill:300:200/rot:720/plain/example.com/a.jpg", limits, defaults)
+	assert.ErrorContains(t, err, `"rot:720"`)
+
+	angled := newImageRequest(defaults)
+	err = angled.validateOptions("/rs:fill:300:200/rot:-30:00000000/plain/example.com/a.jpg", limits, defaults)
+	assert.NoError(t, err)
+	require.Len(t, angled.Steps, 1)
+	assert.Equal(t, "rotate:330:00000000", angled.Steps[0].String())
+
+	byQuery := newImageRequest(defaults)
+	assert.NoError(t, byQuery.setSteps("rot:90,bl:2"))
+	require.Len(t, byQuery.Steps, 2)
+	assert.Error(t, byQuery.setSteps("rot:90,crop:1"))
+}
+
+func TestFocalPoint(t *testing.T) {
+	limits := OutputLimits{}
+	defaults := optionDefaults{}
+	want := image.FocalPoint{X: 0.3, Y: 0.7}
+
+	for _, path := range []string{
+		"/rs:fill:300:200/fp:0.3:0.7/plain/example.com/a.jpg",
+		"/rs:fill:300:200/g:fp:0.3:0.7/plain/example.com/a.jpg",
+	} {
+		req := newImageRequest(defaults)
+		assert.NoError(t, req.validateOptions(path, limits, defaults))
+		assert.Equal(t, image.GravityFocalPoint, req.Gravity)
+		assert.Equal(t, want, req.FocalPoint)
+	}
+
+	req := newImageRequest(defaults)
+	assert.NoError(t, req.setFocalPoint("0.3,0.7"))
+	assert.Equal(t, image.GravityFocalPoint, req.Gravity)
+	assert.Equal(t, want, req.FocalPoint)
+
+	assert.Error(t, req.setFocalPoint("0.3"))
+	assert.Error(t, req.setFocalPoint("1.5,0.5"))
+	assert.Error(t, req.setFocalPoint("NaN,0.5"))
+	assert.Error(t, req.validateOptions("/rs:fill:300:200/fp:0.5:NaN/plain/example.com/a.jpg", limits, defaults))
+	assert.Error(t, req.validateOptions("/rs:fill:300:200/fp:0.3/plain/example.com/a.jpg", limits, defaults))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"runtime"
 	"time"
 
 	"github.com/IKolyas/thumbnailer/internal/logger"
@@ -16,6 +17,12 @@ type Server struct {
 	storage     source.Storage
 	middlewares []func(next http.Handler) http.Handler
 	logger      *logger.Logger
+	limits      OutputLimits
+	presets     map[string]Preset
+	presetsOnly bool
+	defaults    optionDefaults
+	// batchConcurrency - число вариантов, обрабатываемых параллельно в /batch.
+	batchConcurrency int
 }
 
 type Option func(*Server)
@@ -32,10 +39,64 @@ func WithTimeout(timeout time.Duration) Option {
 	}
 }
 
+func WithOutputLimits(limits OutputLimits) Option {
+	return func(s *Server) {
+		s.limits = limits
+	}
+}
+
+// WithPresets задаёт именованные размеры. В режиме presetsOnly доступен
+// только маршрут /preset/.
+func WithPresets(presets map[string]Preset, presetsOnly bool) Option {
+	return func(s *Server) {
+		s.presets = presets
+		s.presetsOnly = presetsOnly
+	}
+}
+
+// WithEnlarge задаёт значение параметра enlarge по умолчанию.
+func WithEnlarge(enlarge bool) Option {
+	return func(s *Server) {
+		s.defaults.Enlarge = enlarge
+	}
+}
+
+// WithMaxDPR ограничивает device pixel ratio (не больше 4).
+func WithMaxDPR(dpr float64) Option {
+	return func(s *Server) {
+		s.defaults.MaxDPR = dpr
+	}
+}
+
+// WithWatermarks задаёт имена водяных знаков, доступных в запросах.
+func WithWatermarks(names []string) Option {
+	return func(s *Server) {
+		s.defaults.Watermarks = names
+	}
+}
+
+// WithTextStyles задаёт имена стилей текста, доступных в запросах.
+func WithTextStyles(names []string) Option {
+	return func(s *Server) {
+		s.defaults.TextStyles = names
+	}
+}
+
+// WithBatchConcurrency ограничивает число вариантов, обрабатываемых
+// параллельно в /batch. По умолчанию равно числу процессоров.
+func WithBatchConcurrency(n int) Option {
+	return func(s *Server) {
+		if n > 0 {
+			s.batchConcurrency = n
+		}
+	}
+}
+
 func NewServer(addr string, storage source.Storage, logger *logger.Logger, opts ...Option) (*Server, error) {
 	srv := &Server{
-		storage: storage,
-		logger:  logger,
+		storage:          storage,
+		logger:           logger,
+		batchConcurrency: runtime.GOMAXPROCS(0),
 	}
 
 	for _, opt := range opts {
@@ -59,7 +120,18 @@ func (s *Server) setupRoutes() http.Handler {
 		server: *s,
 	}
 
-	router.HandleFunc("/fill/", h.Fill)
+	if !s.presetsOnly {
+		router.HandleFunc("/fill/", h.Fill)
+		router.HandleFunc("/resize", h.Resize)
+		router.HandleFunc("/crop/", h.Crop)
+		router.HandleFunc("/blurhash/", h.BlurHash)
+		router.HandleFunc("/lqip/", h.LQIP)
+		router.HandleFunc("/info/", h.Info)
+		router.HandleFunc("/batch", h.Batch)
+		// Опции обработки в пути: /rs:fill:300:200/q:80/plain/{url}.
+		router.HandleFunc("/", h.Process)
+	}
+	router.HandleFunc("/preset/", h.Preset)
 
 	var handler http.Handler = router
 	for i := len(s.middlewares) - 1; i >= 0; i-- {
@@ -69,6 +141,12 @@ func (s *Server) setupRoutes() http.Handler {
 	return handler
 }
 
+// Handler возвращает обработчик запросов со всеми middleware. Используется
+// для прогрева кэша без запуска сервера.
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
 func (s *Server) Start() error {
 	listener, err := net.Listen("tcp", s.server.Addr)
 	if err != nil {
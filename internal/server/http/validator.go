@@ -1,31 +1,605 @@
 package http
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/IKolyas/thumbnailer/internal/core/image"
+	"github.com/IKolyas/thumbnailer/internal/storage/source"
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+const (
+	// maxDPR - верхняя граница device pixel ratio.
+	maxDPR = 4
+	// dprStep - шаг, до которого округляется DPR. Каждое значение DPR даёт
+	// отдельный результат в кэше, поэтому набор значений ограничен.
+	dprStep = 0.5
+	// encodedPrefix отмечает URL источника, закодированный base64url.
+	encodedPrefix = "enc/"
+	// maxTextLength - максимальная длина текста в символах.
+	maxTextLength = 200
+	// defaultTextStyle - стиль текста, если он не указан в запросе.
+	defaultTextStyle = "default"
+	// maxLQIPWidth - максимальная ширина LQIP: плейсхолдер встраивается в
+	// страницу и должен оставаться маленьким.
+	maxLQIPWidth = 64
+	// defaultPaletteSize и maxPaletteSize - число цветов палитры в /info по
+	// умолчанию и его верхняя граница.
+	defaultPaletteSize = 5
+	maxPaletteSize     = 16
+)
+
+var (
+	fillPathRe   = regexp.MustCompile(`^(?P<width>\d+)/(?P<height>\d+)/(?P<url>.+)$`)
+	presetPathRe = regexp.MustCompile(`^(?P<name>[\w-]+)/(?P<url>.+)$`)
+	cropPathRe   = regexp.MustCompile(
+		`^(?P<x>[\d.]+%?)/(?P<y>[\d.]+%?)/(?P<width>[\d.]+%?)/(?P<height>[\d.]+%?)/(?P<url>.+)$`,
+	)
+	sourcePathRe = regexp.MustCompile(`^(?P<url>.+)$`)
+	lqipPathRe   = regexp.MustCompile(`^(?P<width>\d+)/(?P<url>.+)$`)
+	presetRe     = regexp.MustCompile(`^(\d+)x(\d+)$`)
 )
 
-type FillImageRequest struct {
-	ImageURL string
-	Width    int
-	Height   int
+// ImageRequest - общая модель параметров для всех форматов запроса.
+type ImageRequest struct {
+	ImageURL   string
+	Width      int
+	Height     int
+	Mode       image.Action
+	Gravity    image.Gravity
+	FocalPoint image.FocalPoint
+	Enlarge    bool
+	DPR        float64
+	Format     vips.ImageType
+	Quality    int
+	Steps      []image.Operation
+	// Frame - номер кадра анимации начиная с 1, 0 - все кадры.
+	Frame int
+	// Watermark - имя водяного знака из конфигурации.
+	Watermark string
+	// Text - накладываемый текст, TextStyle - имя его стиля из конфигурации.
+	Text      string
+	TextStyle string
+	// KeepICC и KeepCopyright отключают удаление соответствующих метаданных.
+	KeepICC       bool
+	KeepCopyright bool
+	// Colors - число цветов палитры в сведениях об изображении.
+	Colors int
+
+	// pathEnlarge и pathDPR отмечают значения, заданные опциями пути:
+	// parseOptions не заменяет их значениями по умолчанию.
+	pathEnlarge bool
+	pathDPR     bool
 }
 
-func (f *FillImageRequest) validate(urlPath string) error {
-	const prefix = "/fill/"
-	if !strings.HasPrefix(urlPath, prefix) {
-		return fmt.Errorf("invalid URL path format: %q", urlPath)
+// optionDefaults - значения по умолчанию и ограничения для необязательных
+// параметров запроса.
+type optionDefaults struct {
+	Enlarge    bool
+	MaxDPR     float64
+	Watermarks []string
+	TextStyles []string
+}
+
+// OutputLimits ограничивает размеры результата. Нулевое значение означает
+// отсутствие ограничения. Лимиты относятся к размерам в CSS-пикселях, до
+// умножения на DPR: результат для retina-экранов может быть больше MaxWidth
+// и MaxHeight не более чем в maxDpr раз.
+type OutputLimits struct {
+	MinWidth  int
+	MaxWidth  int
+	MinHeight int
+	MaxHeight int
+}
+
+// Preset - именованный размер результата, например thumb=150x150.
+type Preset struct {
+	Width  int
+	Height int
+}
+
+func ParsePreset(value string) (Preset, error) {
+	matches := presetRe.FindStringSubmatch(value)
+	if matches == nil {
+		return Preset{}, fmt.Errorf("invalid preset %q, expected WIDTHxHEIGHT", value)
+	}
+
+	width, err := strconv.Atoi(matches[1])
+	if err != nil {
+		return Preset{}, fmt.Errorf("invalid preset width: %w", err)
+	}
+
+	height, err := strconv.Atoi(matches[2])
+	if err != nil {
+		return Preset{}, fmt.Errorf("invalid preset height: %w", err)
+	}
+
+	if width == 0 && height == 0 {
+		return Preset{}, fmt.Errorf("invalid preset %q: width and height are both zero", value)
+	}
+
+	return Preset{Width: width, Height: height}, nil
+}
+
+// validate разбирает путь вида /fill/{width}/{height}/{url}. Нулевая ширина
+// или высота означает "auto": сторона вычисляется по пропорциям исходника.
+func (f *ImageRequest) validate(urlPath string, limits OutputLimits) error {
+	params, err := matchPath(urlPath, "/fill/", fillPathRe)
+	if err != nil {
+		return err
+	}
+
+	width, err := strconv.Atoi(params["width"])
+	if err != nil {
+		return fmt.Errorf("invalid image width: %w", err)
+	}
+
+	height, err := strconv.Atoi(params["height"])
+	if err != nil {
+		return fmt.Errorf("invalid image height: %w", err)
+	}
+
+	if err := limits.check(width, height); err != nil {
+		return err
+	}
+
+	imageURL, format, err := sourceURL(params["url"])
+	if err != nil {
+		return err
+	}
+
+	f.ImageURL = imageURL
+	f.Width = width
+	f.Height = height
+	f.Mode = image.ImageActionFill
+	f.Format = format
+
+	return nil
+}
+
+// validateQuery разбирает запрос вида /resize?url=...&w=...&h=...&mode=fill.
+// Значения параметров уже декодированы, поэтому URL источника может
+// содержать собственную query-строку.
+func (f *ImageRequest) validateQuery(query url.Values, limits OutputLimits) error {
+	rawURL := query.Get("url")
+	if rawURL == "" {
+		return errors.New("missing url parameter")
+	}
+
+	imageURL, err := canonicalURL(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url parameter: %w", err)
+	}
+
+	width, err := queryInt(query, "w")
+	if err != nil {
+		return fmt.Errorf("invalid image width: %w", err)
+	}
+
+	height, err := queryInt(query, "h")
+	if err != nil {
+		return fmt.Errorf("invalid image height: %w", err)
+	}
+
+	if err := limits.check(width, height); err != nil {
+		return err
+	}
+
+	mode := image.Action(query.Get("mode"))
+	switch mode {
+	case "":
+		mode = image.ImageActionFill
+	case image.ImageActionFill:
+	default:
+		return fmt.Errorf("unsupported mode: %q", mode)
+	}
+
+	f.ImageURL = imageURL
+	f.Width = width
+	f.Height = height
+	f.Mode = mode
+
+	return nil
+}
+
+// presetOptions - параметры запроса, которые маршрут /preset/ принимает в
+// режиме presetsOnly. У них конечный набор значений, поэтому они не дают
+// создавать в кэше неограниченное число вариантов.
+var presetOptions = []string{"format", "dpr"}
+
+// presetQuery оставляет в запросе только presetOptions, остальные параметры
+// игнорируются.
+func presetQuery(query url.Values) url.Values {
+	allowed := make(url.Values, len(presetOptions))
+	for _, name := range presetOptions {
+		if values, ok := query[name]; ok {
+			allowed[name] = values
+		}
+	}
+	return allowed
+}
+
+func (f *ImageRequest) validatePreset(urlPath string, presets map[string]Preset) error {
+	params, err := matchPath(urlPath, "/preset/", presetPathRe)
+	if err != nil {
+		return err
+	}
+
+	preset, ok := presets[params["name"]]
+	if !ok {
+		return fmt.Errorf("unknown preset: %q", params["name"])
+	}
+
+	imageURL, format, err := sourceURL(params["url"])
+	if err != nil {
+		return err
+	}
+
+	f.ImageURL = imageURL
+	f.Width = preset.Width
+	f.Height = preset.Height
+	f.Mode = image.ImageActionFill
+	f.Format = format
+
+	return nil
+}
+
+// newImageRequest создаёт запрос со значениями по умолчанию.
+func newImageRequest(defaults optionDefaults) *ImageRequest {
+	return &ImageRequest{
+		Mode:    image.ImageActionFill,
+		Gravity: image.GravityCentre,
+		Enlarge: defaults.Enlarge,
+	}
+}
+
+// parseOptions разбирает необязательные параметры запроса, общие для всех
+// маршрутов: enlarge, format, q, g, fp, ops, keep, frame, wm, text, ts и
+// dpr. Enlarge и DPR при каждом вызове начинаются со значений по умолчанию,
+// если их не задали опции пути. DPR, не заданный явно, берётся из client
+// hints Sec-CH-DPR и DPR. Порядок шагов проверяется вместе с шагами пути.
+func (f *ImageRequest) parseOptions(query url.Values, header http.Header, defaults optionDefaults) error {
+	if !f.pathEnlarge {
+		f.Enlarge = defaults.Enlarge
+	}
+	if !f.pathDPR {
+		f.DPR = 0
+	}
+
+	setters := []struct {
+		name string
+		set  func(value string) error
+	}{
+		{"enlarge", f.setEnlarge},
+		{"format", f.setFormat},
+		{"q", f.setQuality},
+		{"g", f.setGravity},
+		{"fp", f.setFocalPoint},
+		{"ops", f.setSteps},
+		{"keep", func(value string) error { return f.setKeep(strings.Split(value, ",")...) }},
+		{"frame", f.setFrame},
+		{"wm", func(value string) error { return f.setWatermark(value, defaults.Watermarks) }},
+		{"text", func(value string) error { return f.setText(value, query.Get("ts"), defaults.TextStyles) }},
+		{"dpr", func(value string) error { return f.setDPR(value, defaults.maxDPR()) }},
+	}
+
+	for _, setter := range setters {
+		if value := query.Get(setter.name); value != "" {
+			if err := setter.set(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := image.CheckSteps(f.Steps); err != nil {
+		return err
+	}
+
+	if f.DPR == 0 {
+		f.DPR = hintDPR(header, defaults.maxDPR())
+	}
+
+	return nil
+}
+
+func (f *ImageRequest) setEnlarge(value string) error {
+	enlarge, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("invalid enlarge value: %w", err)
+	}
+	f.Enlarge = enlarge
+	return nil
+}
+
+func (f *ImageRequest) setFormat(value string) error {
+	format, err := image.ParseFormat(value)
+	if err != nil {
+		return err
+	}
+	f.Format = format
+	return nil
+}
+
+func (f *ImageRequest) setQuality(value string) error {
+	quality, err := strconv.Atoi(value)
+	if err != nil || quality < 1 || quality > 100 {
+		return fmt.Errorf("invalid quality value %q: must be between 1 and 100", value)
+	}
+	f.Quality = quality
+	return nil
+}
+
+func (f *ImageRequest) setFrame(value string) error {
+	frame, err := strconv.Atoi(value)
+	if err != nil || frame < 1 {
+		return fmt.Errorf("invalid frame value %q: must be a positive number", value)
+	}
+	f.Frame = frame
+	return nil
+}
+
+func (f *ImageRequest) setWatermark(value string, watermarks []string) error {
+	if !slices.Contains(watermarks, value) {
+		return fmt.Errorf("unknown watermark %q", value)
+	}
+	f.Watermark = value
+	return nil
+}
+
+// setText задаёт текст и его стиль. Без стиля используется стиль default.
+func (f *ImageRequest) setText(text, style string, styles []string) error {
+	if !utf8.ValidString(text) {
+		return errors.New("text must be valid UTF-8")
+	}
+	if utf8.RuneCountInString(text) > maxTextLength {
+		return fmt.Errorf("text is longer than %d characters", maxTextLength)
+	}
+
+	if style == "" {
+		style = defaultTextStyle
+	}
+	if !slices.Contains(styles, style) {
+		return fmt.Errorf("unknown text style %q", style)
+	}
+
+	f.Text = text
+	f.TextStyle = style
+	return nil
+}
+
+// setKeep разбирает список сохраняемых метаданных: icc и copyright.
+func (f *ImageRequest) setKeep(values ...string) error {
+	for _, value := range values {
+		switch value {
+		case "icc":
+			f.KeepICC = true
+		case "copyright":
+			f.KeepCopyright = true
+		default:
+			return fmt.Errorf("invalid keep value %q: must be icc or copyright", value)
+		}
+	}
+	return nil
+}
+
+func (f *ImageRequest) setGravity(value string) error {
+	gravity, err := image.ParseGravity(value)
+	if err != nil {
+		return err
+	}
+	f.Gravity = gravity
+	return nil
+}
+
+// setFocalPoint разбирает точку интереса вида 0.3,0.7.
+func (f *ImageRequest) setFocalPoint(value string) error {
+	x, y, ok := strings.Cut(value, ",")
+	if !ok {
+		return fmt.Errorf("invalid focal point %q: expected x,y", value)
+	}
+
+	fp, err := image.ParseFocalPoint(x, y)
+	if err != nil {
+		return err
+	}
+
+	f.Gravity = image.GravityFocalPoint
+	f.FocalPoint = fp
+	return nil
+}
+
+func (f *ImageRequest) setDPR(value string, limit float64) error {
+	dpr, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(dpr) || math.IsInf(dpr, 0) || dpr < 1 || dpr > limit {
+		return fmt.Errorf("invalid dpr value %q: must be between 1 and %g", value, limit)
+	}
+	f.DPR = roundDPR(dpr, limit)
+	return nil
+}
+
+// hintDPR возвращает DPR из client hints. Некорректные значения не должны
+// ломать запрос, поэтому они приводятся к допустимому диапазону, а NaN и
+// бесконечность пропускаются.
+func hintDPR(header http.Header, limit float64) float64 {
+	for _, name := range []string{"Sec-CH-DPR", "DPR"} {
+		dpr, err := strconv.ParseFloat(header.Get(name), 64)
+		if err == nil && !math.IsNaN(dpr) && !math.IsInf(dpr, 0) {
+			return roundDPR(dpr, limit)
+		}
+	}
+	return 1
+}
+
+// roundDPR округляет DPR до шага dprStep в пределах от 1 до limit.
+func roundDPR(dpr, limit float64) float64 {
+	return math.Min(math.Max(math.Round(dpr/dprStep)*dprStep, 1), limit)
+}
+
+func (d optionDefaults) maxDPR() float64 {
+	if d.MaxDPR >= 1 && d.MaxDPR < maxDPR {
+		return d.MaxDPR
+	}
+	return maxDPR
+}
+
+// validateCrop разбирает путь вида /crop/{x}/{y}/{width}/{height}/{url}.
+// Координаты задаются в пикселях исходника или в процентах (25%), область
+// вырезается без последующего ресайза.
+func (f *ImageRequest) validateCrop(urlPath string) error {
+	params, err := matchPath(urlPath, "/crop/", cropPathRe)
+	if err != nil {
+		return err
+	}
+
+	crop, err := image.ParseOperation("crop", []string{params["x"], params["y"], params["width"], params["height"]})
+	if err != nil {
+		return err
+	}
+
+	imageURL, format, err := sourceURL(params["url"])
+	if err != nil {
+		return err
 	}
 
-	fmt.Println(urlPath)
+	f.ImageURL = imageURL
+	f.Mode = image.ImageActionCrop
+	f.Format = format
+	f.Steps = []image.Operation{crop}
 
-	re := regexp.MustCompile(`^(?P<width>\d+)/(?P<height>\d+)/(?P<url>.+)$`)
+	return nil
+}
+
+// validateBlurHash разбирает путь вида /blurhash/{url}.
+func (f *ImageRequest) validateBlurHash(urlPath string) error {
+	return f.validateSource(urlPath, "/blurhash/", image.ImageActionBlurHash)
+}
+
+// validateInfo разбирает путь вида /info/{url} и необязательный параметр
+// colors - число цветов палитры.
+func (f *ImageRequest) validateInfo(urlPath string, query url.Values) error {
+	if err := f.validateSource(urlPath, "/info/", image.ImageActionInfo); err != nil {
+		return err
+	}
+
+	f.Colors = defaultPaletteSize
+	if value := query.Get("colors"); value != "" {
+		colors, err := strconv.Atoi(value)
+		if err != nil || colors < 1 || colors > maxPaletteSize {
+			return fmt.Errorf("invalid colors value %q: must be between 1 and %d", value, maxPaletteSize)
+		}
+		f.Colors = colors
+	}
+
+	return nil
+}
+
+// validateSource разбирает путь, содержащий после префикса только URL
+// источника.
+func (f *ImageRequest) validateSource(urlPath, prefix string, action image.Action) error {
+	params, err := matchPath(urlPath, prefix, sourcePathRe)
+	if err != nil {
+		return err
+	}
+
+	imageURL, _, err := sourceURL(params["url"])
+	if err != nil {
+		return err
+	}
+
+	f.ImageURL = imageURL
+	f.Mode = action
+
+	return nil
+}
+
+// validateLQIP разбирает путь вида /lqip/{width}/{url}.
+func (f *ImageRequest) validateLQIP(urlPath string) error {
+	params, err := matchPath(urlPath, "/lqip/", lqipPathRe)
+	if err != nil {
+		return err
+	}
+
+	width, err := strconv.Atoi(params["width"])
+	if err != nil || width < 1 || width > maxLQIPWidth {
+		return fmt.Errorf("invalid placeholder width %q: must be between 1 and %d", params["width"], maxLQIPWidth)
+	}
+
+	imageURL, _, err := sourceURL(params["url"])
+	if err != nil {
+		return err
+	}
+
+	f.ImageURL = imageURL
+	f.Width = width
+	f.Mode = image.ImageActionLQIP
+
+	return nil
+}
+
+func (l OutputLimits) check(width, height int) error {
+	if width == 0 && height == 0 {
+		return errors.New("width and height can't both be zero")
+	}
+
+	if err := checkRange("width", width, l.MinWidth, l.MaxWidth); err != nil {
+		return err
+	}
+
+	return checkRange("height", height, l.MinHeight, l.MaxHeight)
+}
+
+// checkRange проверяет значение размера; ноль означает "не задано".
+func checkRange(name string, value, minValue, maxValue int) error {
+	if value == 0 {
+		return nil
+	}
+
+	if minValue > 0 && value < minValue {
+		return fmt.Errorf("image %s %d is less than %d", name, value, minValue)
+	}
+
+	if maxValue > 0 && value > maxValue {
+		return fmt.Errorf("image %s %d is greater than %d", name, value, maxValue)
+	}
+
+	return nil
+}
+
+func queryInt(query url.Values, name string) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if number < 0 {
+		return 0, fmt.Errorf("negative value: %d", number)
+	}
+
+	return number, nil
+}
+
+func matchPath(urlPath, prefix string, re *regexp.Regexp) (map[string]string, error) {
+	if !strings.HasPrefix(urlPath, prefix) {
+		return nil, fmt.Errorf("invalid URL path format: %q", urlPath)
+	}
 
 	matches := re.FindStringSubmatch(urlPath[len(prefix):])
 	if matches == nil {
-		return fmt.Errorf("invalid URL path format: %q", urlPath)
+		return nil, fmt.Errorf("invalid URL path format: %q", urlPath)
 	}
 
 	params := make(map[string]string)
@@ -35,35 +609,70 @@ func (f *FillImageRequest) validate(urlPath string) error {
 		}
 	}
 
-	w := params["width"]
-	h := params["height"]
-	rawURL := params["url"]
+	return params, nil
+}
+
+// sourceURL возвращает URL источника из последнего сегмента пути. Сегмент
+// вида enc/{base64url}[.ext] содержит URL, закодированный base64url, и
+// необязательное расширение, задающее формат результата. Такой URL не
+// искажается при нормализации пути.
+func sourceURL(segment string) (string, vips.ImageType, error) {
+	encoded, ok := strings.CutPrefix(segment, encodedPrefix)
+	if !ok {
+		imageURL, err := canonicalURL(segment)
+		return imageURL, vips.ImageTypeUnknown, err
+	}
 
-	width, err := strconv.Atoi(w)
+	format := vips.ImageTypeUnknown
+	if dot := strings.LastIndexByte(encoded, '.'); dot >= 0 {
+		var err error
+		format, err = image.ParseFormat(encoded[dot+1:])
+		if err != nil {
+			return "", vips.ImageTypeUnknown, err
+		}
+		encoded = encoded[:dot]
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
 	if err != nil {
-		return fmt.Errorf("invalid image width: %w", err)
+		return "", vips.ImageTypeUnknown, fmt.Errorf("invalid encoded source URL: %w", err)
 	}
 
-	height, err := strconv.Atoi(h)
+	imageURL, err := canonicalURL(string(decoded))
 	if err != nil {
-		return fmt.Errorf("invalid image height: %w", err)
+		return "", vips.ImageTypeUnknown, fmt.Errorf("invalid encoded source URL: %w", err)
 	}
 
-	if strings.HasPrefix(rawURL, "http:/") && !strings.HasPrefix(rawURL, "http://") {
-		rawURL = strings.Replace(rawURL, "http:/", "http://", 1)
+	return imageURL, format, nil
+}
+
+// canonicalURL приводит URL источника к одному виду для всех форматов
+// запроса: восстанавливает схему и экранирует символы так же, как
+// url.URL.String. Один исходник должен давать один ключ кэша.
+func canonicalURL(rawURL string) (string, error) {
+	imageURL, err := url.Parse(normalizeURL(rawURL))
+	if err != nil {
+		return "", err
 	}
+	if imageURL.Host == "" {
+		return "", fmt.Errorf("missing host in source URL %q", rawURL)
+	}
+	return imageURL.String(), nil
+}
 
-	if strings.HasPrefix(rawURL, "https:/") && !strings.HasPrefix(rawURL, "https://") {
-		rawURL = strings.Replace(rawURL, "https:/", "https://", 1)
+// normalizeURL восстанавливает схему, из которой очистка пути убрала второй
+// слэш, и добавляет http:// к URL без схемы. URL локальных исходников
+// (file://{root}/{path}) сохраняют свою схему.
+func normalizeURL(rawURL string) string {
+	for _, scheme := range []string{"http", "https", source.LocalScheme} {
+		if strings.HasPrefix(rawURL, scheme+":/") && !strings.HasPrefix(rawURL, scheme+"://") {
+			rawURL = strings.Replace(rawURL, scheme+":/", scheme+"://", 1)
+		}
 	}
 
 	if !strings.Contains(rawURL, "://") {
 		rawURL = "http://" + rawURL
 	}
 
-	f.ImageURL = rawURL
-	f.Width = width
-	f.Height = height
-
-	return nil
+	return rawURL
 }
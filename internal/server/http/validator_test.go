@@ -0,0 +1,410 @@
+package http
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/IKolyas/thumbnailer/internal/core/image"
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageRequestValidate(t *testing.T) {
+	limits := OutputLimits{MinWidth: 10, MaxWidth: 1000, MinHeight: 10, MaxHeight: 1000}
+
+	t.Run("valid request", func(t *testing.T) {
+		req := &ImageRequest{}
+		err := req.validate("/fill/300/200/example.com/image.jpg", limits)
+		assert.NoError(t, err)
+		assert.Equal(t, "http://example.com/image.jpg", req.ImageURL)
+		assert.Equal(t, 300, req.Width)
+		assert.Equal(t, 200, req.Height)
+	})
+
+	t.Run("cleaned scheme is restored", func(t *testing.T) {
+		req := &ImageRequest{}
+		err := req.validate("/fill/300/200/https:/example.com/image.jpg", limits)
+		assert.NoError(t, err)
+		assert.Equal(t, "https://example.com/image.jpg", req.ImageURL)
+	})
+
+	t.Run("local source keeps its scheme", func(t *testing.T) {
+		req := &ImageRequest{}
+		err := req.validate("/fill/300/200/file:/assets/photos/image.jpg", limits)
+		assert.NoError(t, err)
+		assert.Equal(t, "file://assets/photos/image.jpg", req.ImageURL)
+
+		query := url.Values{"url": {"file://assets/photos/image.jpg"}, "w": {"300"}}
+		assert.NoError(t, req.validateQuery(query, limits))
+		assert.Equal(t, "file://assets/photos/image.jpg", req.ImageURL)
+	})
+
+	t.Run("auto dimension", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.validate("/fill/0/300/example.com/image.jpg", limits))
+		assert.Equal(t, 0, req.Width)
+		assert.Equal(t, 300, req.Height)
+	})
+
+	t.Run("size out of limits", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.Error(t, req.validate("/fill/99999/99999/example.com/image.jpg", limits))
+		assert.Error(t, req.validate("/fill/5/200/example.com/image.jpg", limits))
+		assert.Error(t, req.validate("/fill/0/0/example.com/image.jpg", limits))
+	})
+
+	t.Run("invalid path", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.Error(t, req.validate("/fill/abc/200/example.com/image.jpg", limits))
+		assert.Error(t, req.validate("/fit/300/200/example.com/image.jpg", limits))
+	})
+}
+
+func TestPresets(t *testing.T) {
+	t.Run("parse preset", func(t *testing.T) {
+		preset, err := ParsePreset("600x400")
+		assert.NoError(t, err)
+		assert.Equal(t, Preset{Width: 600, Height: 400}, preset)
+
+		_, err = ParsePreset("600")
+		assert.Error(t, err)
+		_, err = ParsePreset("0x0")
+		assert.Error(t, err)
+	})
+
+	t.Run("validate preset", func(t *testing.T) {
+		presets := map[string]Preset{"thumb": {Width: 150, Height: 150}}
+
+		req := &ImageRequest{}
+		err := req.validatePreset("/preset/thumb/example.com/image.jpg", presets)
+		assert.NoError(t, err)
+		assert.Equal(t, "http://example.com/image.jpg", req.ImageURL)
+		assert.Equal(t, 150, req.Width)
+		assert.Equal(t, 150, req.Height)
+
+		assert.Error(t, req.validatePreset("/preset/card/example.com/image.jpg", presets))
+	})
+
+	t.Run("presets only query", func(t *testing.T) {
+		presets := map[string]Preset{"thumb": {Width: 150, Height: 150}}
+		key := func(t *testing.T, query url.Values) string {
+			t.Helper()
+
+			req := newImageRequest(optionDefaults{})
+			require.NoError(t, req.validatePreset("/preset/thumb/example.com/image.jpg", presets))
+			require.NoError(t, req.parseOptions(presetQuery(query), http.Header{}, optionDefaults{}))
+			return (&PreviewerHandler{}).createImageData(req).String()
+		}
+
+		// Параметры вне presetOptions не меняют ключ кэша.
+		plain := key(t, url.Values{"format": {"webp"}, "dpr": {"2"}})
+		busted := key(t, url.Values{
+			"format": {"webp"}, "dpr": {"2"}, "q": {"37"}, "ops": {"bl:3"}, "fp": {"0.1:0.2"},
+			"enlarge": {"true"}, "frame": {"2"}, "keep": {"icc"},
+		})
+		assert.Equal(t, plain, busted)
+		assert.NotEqual(t, plain, key(t, url.Values{"format": {"webp"}}))
+	})
+}
+
+func TestParseOptions(t *testing.T) {
+	t.Run("enlarge", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.parseOptions(url.Values{}, http.Header{}, optionDefaults{Enlarge: true}))
+		assert.True(t, req.Enlarge)
+
+		assert.NoError(t, req.parseOptions(url.Values{"enlarge": {"0"}}, http.Header{}, optionDefaults{Enlarge: true}))
+		assert.False(t, req.Enlarge)
+
+		assert.Error(t, req.parseOptions(url.Values{"enlarge": {"maybe"}}, http.Header{}, optionDefaults{}))
+	})
+
+	t.Run("dpr", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.parseOptions(url.Values{}, http.Header{}, optionDefaults{}))
+		assert.Equal(t, 1.0, req.DPR)
+
+		assert.NoError(t, req.parseOptions(url.Values{"dpr": {"2"}}, http.Header{}, optionDefaults{}))
+		assert.Equal(t, 2.0, req.DPR)
+
+		assert.Error(t, req.parseOptions(url.Values{"dpr": {"5"}}, http.Header{}, optionDefaults{}))
+		assert.Error(t, req.parseOptions(url.Values{"dpr": {"3"}}, http.Header{}, optionDefaults{MaxDPR: 2}))
+		assert.Error(t, req.parseOptions(url.Values{"dpr": {"0.5"}}, http.Header{}, optionDefaults{}))
+		assert.Error(t, req.parseOptions(url.Values{"dpr": {"NaN"}}, http.Header{}, optionDefaults{}))
+		assert.Error(t, req.parseOptions(url.Values{"dpr": {"Inf"}}, http.Header{}, optionDefaults{}))
+
+		// Близкие значения дают один вариант в кэше.
+		for value, want := range map[string]float64{"1.0001": 1, "1.3": 1.5, "2.74": 2.5, "2.75": 3} {
+			assert.NoError(t, req.parseOptions(url.Values{"dpr": {value}}, http.Header{}, optionDefaults{}))
+			assert.Equal(t, want, req.DPR, value)
+		}
+	})
+
+	t.Run("dpr client hints", func(t *testing.T) {
+		req := &ImageRequest{}
+		header := http.Header{"Sec-Ch-Dpr": {"3"}, "Dpr": {"2"}}
+		assert.NoError(t, req.parseOptions(url.Values{}, header, optionDefaults{}))
+		assert.Equal(t, 3.0, req.DPR)
+
+		header = http.Header{"Dpr": {"10"}}
+		assert.NoError(t, req.parseOptions(url.Values{}, header, optionDefaults{MaxDPR: 2}))
+		assert.Equal(t, 2.0, req.DPR)
+
+		assert.NoError(t, req.parseOptions(url.Values{"dpr": {"1.5"}}, header, optionDefaults{}))
+		assert.Equal(t, 1.5, req.DPR)
+
+		header = http.Header{"Sec-Ch-Dpr": {"NaN"}, "Dpr": {"2"}}
+		assert.NoError(t, req.parseOptions(url.Values{}, header, optionDefaults{}))
+		assert.Equal(t, 2.0, req.DPR)
+
+		header = http.Header{"Dpr": {"-Inf"}}
+		assert.NoError(t, req.parseOptions(url.Values{}, header, optionDefaults{}))
+		assert.Equal(t, 1.0, req.DPR)
+
+		header = http.Header{"Sec-Ch-Dpr": {"2.625"}}
+		assert.NoError(t, req.parseOptions(url.Values{}, header, optionDefaults{}))
+		assert.Equal(t, 2.5, req.DPR)
+	})
+
+	t.Run("keep metadata", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.parseOptions(url.Values{}, http.Header{}, optionDefaults{}))
+		assert.False(t, req.KeepICC)
+		assert.False(t, req.KeepCopyright)
+
+		assert.NoError(t, req.parseOptions(url.Values{"keep": {"icc,copyright"}}, http.Header{}, optionDefaults{}))
+		assert.True(t, req.KeepICC)
+		assert.True(t, req.KeepCopyright)
+
+		assert.Error(t, req.parseOptions(url.Values{"keep": {"gps"}}, http.Header{}, optionDefaults{}))
+	})
+
+	t.Run("frame", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.parseOptions(url.Values{"frame": {"2"}}, http.Header{}, optionDefaults{}))
+		assert.Equal(t, 2, req.Frame)
+
+		assert.Error(t, req.parseOptions(url.Values{"frame": {"0"}}, http.Header{}, optionDefaults{}))
+		assert.Error(t, req.parseOptions(url.Values{"frame": {"first"}}, http.Header{}, optionDefaults{}))
+	})
+
+	t.Run("watermark", func(t *testing.T) {
+		defaults := optionDefaults{Watermarks: []string{"stock"}}
+		req := &ImageRequest{}
+		assert.NoError(t, req.parseOptions(url.Values{"wm": {"stock"}}, http.Header{}, defaults))
+		assert.Equal(t, "stock", req.Watermark)
+
+		assert.Error(t, req.parseOptions(url.Values{"wm": {"other"}}, http.Header{}, defaults))
+		assert.Error(t, req.parseOptions(url.Values{"wm": {"stock"}}, http.Header{}, optionDefaults{}))
+	})
+
+	t.Run("text", func(t *testing.T) {
+		defaults := optionDefaults{TextStyles: []string{"default", "title"}}
+		req := &ImageRequest{}
+		assert.NoError(t, req.parseOptions(url.Values{"text": {"Привет, мир"}}, http.Header{}, defaults))
+		assert.Equal(t, "Привет, мир", req.Text)
+		assert.Equal(t, "default", req.TextStyle)
+
+		query := url.Values{"text": {"Заголовок"}, "ts": {"title"}}
+		assert.NoError(t, req.parseOptions(query, http.Header{}, defaults))
+		assert.Equal(t, "title", req.TextStyle)
+
+		query = url.Values{"text": {"Заголовок"}, "ts": {"other"}}
+		assert.Error(t, req.parseOptions(query, http.Header{}, defaults))
+
+		long := strings.Repeat("я", maxTextLength+1)
+		assert.Error(t, req.parseOptions(url.Values{"text": {long}}, http.Header{}, defaults))
+	})
+}
+
+func TestValidateQuery(t *testing.T) {
+	limits := OutputLimits{MaxWidth: 1000, MaxHeight: 1000}
+
+	t.Run("valid request", func(t *testing.T) {
+		req := &ImageRequest{}
+		query := url.Values{
+			"url": {"https://example.com/image.jpg?v=2&size=large"},
+			"w":   {"300"},
+			"h":   {"200"},
+		}
+		assert.NoError(t, req.validateQuery(query, limits))
+		assert.Equal(t, "https://example.com/image.jpg?v=2&size=large", req.ImageURL)
+		assert.Equal(t, 300, req.Width)
+		assert.Equal(t, 200, req.Height)
+		assert.Equal(t, image.ImageActionFill, req.Mode)
+	})
+
+	t.Run("same model as path API", func(t *testing.T) {
+		byPath := &ImageRequest{}
+		assert.NoError(t, byPath.validate("/fill/300/0/example.com/image.jpg", limits))
+
+		byQuery := &ImageRequest{}
+		query := url.Values{"url": {"example.com/image.jpg"}, "w": {"300"}, "mode": {"fill"}}
+		assert.NoError(t, byQuery.validateQuery(query, limits))
+
+		assert.Equal(t, byPath, byQuery)
+	})
+
+	t.Run("same cache key for escaped source", func(t *testing.T) {
+		defaults := optionDefaults{}
+
+		byPath := newImageRequest(defaults)
+		require.NoError(t, byPath.validate("/fill/300/200/example.com/a b.jpg", limits))
+
+		byOptions := newImageRequest(defaults)
+		require.NoError(t, byOptions.validateOptions("/w:300/h:200/plain/example.com/a b.jpg", limits, defaults))
+
+		byQuery := newImageRequest(defaults)
+		query := url.Values{"url": {"example.com/a b.jpg"}, "w": {"300"}, "h": {"200"}}
+		require.NoError(t, byQuery.validateQuery(query, limits))
+		assert.Equal(t, "http://example.com/a%20b.jpg", byQuery.ImageURL)
+
+		handler := &PreviewerHandler{}
+		key := handler.createImageData(byQuery).String()
+		assert.Equal(t, key, handler.createImageData(byPath).String())
+		assert.Equal(t, key, handler.createImageData(byOptions).String())
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.Error(t, req.validateQuery(url.Values{"w": {"300"}}, limits))
+		assert.Error(t, req.validateQuery(url.Values{"url": {"example.com/a.jpg"}, "w": {"-1"}}, limits))
+		assert.Error(t, req.validateQuery(url.Values{"url": {"example.com/a.jpg"}, "w": {"5000"}}, limits))
+		assert.Error(t, req.validateQuery(url.Values{"url": {"example.com/a.jpg"}, "w": {"300"}, "mode": {"fit"}}, limits))
+	})
+}
+
+func TestParseFormatOptions(t *testing.T) {
+	req := &ImageRequest{}
+	query := url.Values{"format": {"webp"}, "q": {"80"}}
+	assert.NoError(t, req.parseOptions(query, http.Header{}, optionDefaults{}))
+	assert.Equal(t, vips.ImageTypeWEBP, req.Format)
+	assert.Equal(t, 80, req.Quality)
+
+	assert.Error(t, req.parseOptions(url.Values{"format": {"bmp"}}, http.Header{}, optionDefaults{}))
+	assert.Error(t, req.parseOptions(url.Values{"q": {"101"}}, http.Header{}, optionDefaults{}))
+}
+
+func TestEncodedSourceURL(t *testing.T) {
+	limits := OutputLimits{}
+	sourceURL := "https://example.com/path//image.jpg?v=2#top"
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(sourceURL))
+
+	t.Run("without extension", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.validate("/fill/300/200/enc/"+encoded, limits))
+		assert.Equal(t, sourceURL, req.ImageURL)
+		assert.Equal(t, vips.ImageTypeUnknown, req.Format)
+	})
+
+	t.Run("with extension", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.validate("/fill/300/200/enc/"+encoded+".webp", limits))
+		assert.Equal(t, sourceURL, req.ImageURL)
+		assert.Equal(t, vips.ImageTypeWEBP, req.Format)
+	})
+
+	t.Run("preset", func(t *testing.T) {
+		req := &ImageRequest{}
+		presets := map[string]Preset{"thumb": {Width: 150, Height: 150}}
+		assert.NoError(t, req.validatePreset("/preset/thumb/enc/"+encoded+".png", presets))
+		assert.Equal(t, sourceURL, req.ImageURL)
+		assert.Equal(t, vips.ImageTypePNG, req.Format)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.Error(t, req.validate("/fill/300/200/enc/!!!", limits))
+		assert.Error(t, req.validate("/fill/300/200/enc/"+encoded+".bmp", limits))
+	})
+}
+
+func TestValidateCrop(t *testing.T) {
+	t.Run("pixels", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.validateCrop("/crop/10/20/300/200/example.com/image.jpg"))
+		assert.Equal(t, "http://example.com/image.jpg", req.ImageURL)
+		assert.Equal(t, image.ImageActionCrop, req.Mode)
+		require.Len(t, req.Steps, 1)
+		assert.Equal(t, "crop:10:20:300:200", req.Steps[0].String())
+	})
+
+	t.Run("percentage", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.validateCrop("/crop/10%/12.5%/50%/50%/example.com/image.jpg"))
+		require.Len(t, req.Steps, 1)
+		assert.Equal(t, "crop:10%:12.5%:50%:50%", req.Steps[0].String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.Error(t, req.validateCrop("/crop/10/20/0/200/example.com/image.jpg"))
+		assert.Error(t, req.validateCrop("/crop/10/20/150%/50%/example.com/image.jpg"))
+		assert.Error(t, req.validateCrop("/crop/10.5/20/300/200/example.com/image.jpg"))
+		assert.Error(t, req.validateCrop("/crop/10/20/300/example.com/image.jpg"))
+	})
+}
+
+func TestValidatePlaceholders(t *testing.T) {
+	t.Run("blurhash", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.validateBlurHash("/blurhash/example.com/image.jpg"))
+		assert.Equal(t, "http://example.com/image.jpg", req.ImageURL)
+		assert.Equal(t, image.ImageActionBlurHash, req.Mode)
+
+		assert.Error(t, req.validateBlurHash("/blurhash/"))
+	})
+
+	t.Run("lqip", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.validateLQIP("/lqip/16/https:/example.com/image.jpg"))
+		assert.Equal(t, "https://example.com/image.jpg", req.ImageURL)
+		assert.Equal(t, 16, req.Width)
+		assert.Equal(t, image.ImageActionLQIP, req.Mode)
+
+		assert.Error(t, req.validateLQIP("/lqip/0/example.com/image.jpg"))
+		assert.Error(t, req.validateLQIP("/lqip/65/example.com/image.jpg"))
+		assert.Error(t, req.validateLQIP("/lqip/example.com/image.jpg"))
+	})
+}
+
+func TestValidateInfo(t *testing.T) {
+	t.Run("default palette", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.validateInfo("/info/example.com/image.jpg", url.Values{}))
+		assert.Equal(t, "http://example.com/image.jpg", req.ImageURL)
+		assert.Equal(t, image.ImageActionInfo, req.Mode)
+		assert.Equal(t, defaultPaletteSize, req.Colors)
+	})
+
+	t.Run("colors", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.NoError(t, req.validateInfo("/info/example.com/image.jpg", url.Values{"colors": {"8"}}))
+		assert.Equal(t, 8, req.Colors)
+
+		assert.Error(t, req.validateInfo("/info/example.com/image.jpg", url.Values{"colors": {"17"}}))
+		assert.Error(t, req.validateInfo("/info/example.com/image.jpg", url.Values{"colors": {"0"}}))
+		assert.Error(t, req.validateInfo("/info/example.com/image.jpg", url.Values{"colors": {"many"}}))
+	})
+
+	t.Run("invalid path", func(t *testing.T) {
+		req := &ImageRequest{}
+		assert.Error(t, req.validateInfo("/info/", url.Values{}))
+		assert.Error(t, req.validateInfo("/information/example.com/image.jpg", url.Values{}))
+	})
+}
+
+func TestContentDPR(t *testing.T) {
+	req := &ImageRequest{Width: 300, DPR: 2}
+	assert.Equal(t, 2.0, contentDPR(req, 600, 400))
+
+	// Без увеличения результат ограничен исходником шириной 400.
+	assert.Equal(t, 1.33, contentDPR(req, 400, 267))
+
+	assert.Equal(t, 1.5, contentDPR(&ImageRequest{Height: 200, DPR: 2}, 500, 300))
+	assert.Equal(t, 1.0, contentDPR(&ImageRequest{DPR: 2}, 500, 300))
+}
@@ -2,10 +2,13 @@ package memory
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
 	"path/filepath"
 	"slices"
 	"sync"
+	"time"
 
 	"github.com/IKolyas/thumbnailer/internal/core/image"
 	"github.com/IKolyas/thumbnailer/internal/storage/source"
@@ -17,9 +20,10 @@ type LRUStorage struct {
 	order      []string
 	mu         sync.Mutex
 	storageDir string
+	origin     source.Storage
 }
 
-func NewLRUStorage(capacity int, storageDir string) (*LRUStorage, error) {
+func NewLRUStorage(capacity int, storageDir string, origin source.Storage) (*LRUStorage, error) {
 	if err := os.MkdirAll(storageDir, 0o755); err != nil {
 		return nil, err
 	}
@@ -30,32 +34,118 @@ func NewLRUStorage(capacity int, storageDir string) (*LRUStorage, error) {
 		cache:      make(map[string]string),
 		order:      make([]string, 0, capacity),
 		storageDir: storageDir,
+		origin:     origin,
 	}, nil
 }
 
-func (s *LRUStorage) Get(ctx context.Context, imgData *image.ImgData) ([]byte, error) {
-	key := imgData.String()
+// Load добавляет в кэш файлы, оставшиеся в storageDir от предыдущего запуска
+// или записанные командой warm. Более новые файлы считаются недавно
+// использованными, файлы сверх ёмкости удаляются.
+func (s *LRUStorage) Load() error {
+	entries, err := os.ReadDir(s.storageDir)
+	if err != nil {
+		return err
+	}
+
+	type cachedFile struct {
+		key     string
+		modTime time.Time
+	}
+
+	files := make([]cachedFile, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isCacheKey(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, cachedFile{key: entry.Name(), modTime: info.ModTime()})
+	}
+
+	slices.SortFunc(files, func(a, b cachedFile) int {
+		return b.modTime.Compare(a.modTime)
+	})
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if filePath, ok := s.cache[key]; ok {
-		s.moveToFront(key)
-		return os.ReadFile(filePath)
+	for _, file := range files {
+		if _, ok := s.cache[file.key]; ok {
+			continue
+		}
+
+		filePath := filepath.Join(s.storageDir, file.key)
+		if len(s.order) >= s.capacity {
+			if err := os.Remove(filePath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		s.cache[file.key] = filePath
+		s.order = append(s.order, file.key)
+	}
+
+	return nil
+}
+
+// isCacheKey проверяет, что имя файла - ключ кэша (sha256 в hex), чтобы не
+// трогать посторонние файлы в storageDir.
+func isCacheKey(name string) bool {
+	if len(name) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
+
+// Get возвращает результат из кэша или получает его из origin. Блокировка
+// не удерживается во время обработки, поэтому разные изображения
+// обрабатываются параллельно.
+func (s *LRUStorage) Get(ctx context.Context, imgData *image.ImgData) ([]byte, error) {
+	key := imgData.String()
+
+	if data, ok, err := s.lookup(key); ok {
+		return data, err
 	}
 
-	data, err := source.Get(ctx, imgData)
+	data, err := s.origin.Get(ctx, imgData)
 	if err != nil {
 		return nil, err
 	}
 
-	err = s.addToCache(key, data)
-	if err != nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Тот же результат мог быть добавлен параллельным запросом.
+	if _, ok := s.cache[key]; ok {
+		s.moveToFront(key)
+		return data, nil
+	}
+
+	if err := s.addToCache(key, data); err != nil {
 		return nil, err
 	}
 
 	return data, nil
 }
 
+func (s *LRUStorage) lookup(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filePath, ok := s.cache[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	s.moveToFront(key)
+	data, err := os.ReadFile(filePath)
+	return data, true, err
+}
+
 func (s *LRUStorage) addToCache(key string, imgData []byte) error {
 	if len(s.order) >= s.capacity {
 		oldest := s.order[len(s.order)-1]
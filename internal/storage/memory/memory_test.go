@@ -1,11 +1,16 @@
 package memory
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/IKolyas/thumbnailer/internal/core/image"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLRU(t *testing.T) {
@@ -15,7 +20,7 @@ func TestLRU(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	t.Run("basic add and get", func(t *testing.T) {
-		cache, err := NewLRUStorage(2, tempDir)
+		cache, err := NewLRUStorage(2, tempDir, nil)
 		assert.NoError(t, err)
 
 		// Add first item
@@ -34,7 +39,7 @@ func TestLRU(t *testing.T) {
 	})
 
 	t.Run("eviction when capacity exceeded", func(t *testing.T) {
-		cache, err := NewLRUStorage(2, tempDir)
+		cache, err := NewLRUStorage(2, tempDir, nil)
 		assert.NoError(t, err)
 
 		err = cache.addToCache("key1", []byte("value1"))
@@ -55,7 +60,7 @@ func TestLRU(t *testing.T) {
 	})
 
 	t.Run("move to front on access", func(t *testing.T) {
-		cache, err := NewLRUStorage(3, tempDir)
+		cache, err := NewLRUStorage(3, tempDir, nil)
 		assert.NoError(t, err)
 
 		err = cache.addToCache("key1", []byte("value1"))
@@ -75,7 +80,7 @@ func TestLRU(t *testing.T) {
 	})
 
 	t.Run("clear cache", func(t *testing.T) {
-		cache, err := NewLRUStorage(2, tempDir)
+		cache, err := NewLRUStorage(2, tempDir, nil)
 		assert.NoError(t, err)
 
 		err = cache.addToCache("key1", []byte("value1"))
@@ -95,4 +100,92 @@ func TestLRU(t *testing.T) {
 		_, err = os.Stat(filepath.Join(tempDir, "key2"))
 		assert.True(t, os.IsNotExist(err))
 	})
+
+	t.Run("placeholders alongside images", func(t *testing.T) {
+		origin := &fakeOrigin{}
+		cache, err := NewLRUStorage(3, tempDir, origin)
+		require.NoError(t, err)
+
+		const imageURL = "http://example.com/a.jpg"
+		requests := []*image.ImgData{
+			{ImageURL: imageURL, Action: image.ImageActionFill, Width: 300},
+			{ImageURL: imageURL, Action: image.ImageActionBlurHash},
+			{ImageURL: imageURL, Action: image.ImageActionLQIP, Width: 16},
+		}
+
+		for range 2 {
+			for _, req := range requests {
+				data, err := cache.Get(context.Background(), req)
+				require.NoError(t, err)
+				assert.Equal(t, string(req.Action), string(data))
+			}
+		}
+
+		assert.Equal(t, 3, origin.calls)
+		assert.Len(t, cache.cache, 3)
+	})
+
+	t.Run("concurrent gets", func(t *testing.T) {
+		cache, err := NewLRUStorage(2, tempDir, &fakeOrigin{})
+		require.NoError(t, err)
+
+		req := &image.ImgData{ImageURL: "http://example.com/b.jpg", Action: image.ImageActionFill, Width: 100}
+
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data, err := cache.Get(context.Background(), req)
+				assert.NoError(t, err)
+				assert.Equal(t, "fill", string(data))
+			}()
+		}
+		wg.Wait()
+
+		assert.Len(t, cache.cache, 1)
+		assert.Equal(t, []string{req.String()}, cache.order)
+	})
+
+	t.Run("load persisted files", func(t *testing.T) {
+		dir := t.TempDir()
+
+		keys := make([]string, 3)
+		for i := range keys {
+			keys[i] = (&image.ImgData{ImageURL: "http://example.com/c.jpg", Width: i + 1}).String()
+			filePath := filepath.Join(dir, keys[i])
+			require.NoError(t, os.WriteFile(filePath, []byte("data"), 0o600))
+			modTime := time.Now().Add(time.Duration(i) * time.Minute)
+			require.NoError(t, os.Chtimes(filePath, modTime, modTime))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("keep"), 0o600))
+
+		cache, err := NewLRUStorage(2, dir, nil)
+		require.NoError(t, err)
+		require.NoError(t, cache.Load())
+
+		// Самый старый файл не помещается в кэш и удаляется.
+		assert.Equal(t, []string{keys[2], keys[1]}, cache.order)
+		assert.NoFileExists(t, filepath.Join(dir, keys[0]))
+		assert.FileExists(t, filepath.Join(dir, "notes.txt"))
+
+		data, ok, err := cache.lookup(keys[1])
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "data", string(data))
+	})
+}
+
+// fakeOrigin возвращает имя действия вместо результата обработки.
+type fakeOrigin struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (o *fakeOrigin) Get(_ context.Context, imgData *image.ImgData) ([]byte, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.calls++
+	return []byte(imgData.Action), nil
 }
@@ -0,0 +1,156 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// LocalScheme - схема URL исходников из локальной файловой системы.
+const LocalScheme = "file"
+
+// Local читает исходники из каталогов файловой системы, например с
+// NFS-монтирования. URL имеет вид file://{root}/{path}, где root - имя
+// корневого каталога из конфига. Файлы вне корня недоступны, в том числе
+// через символические ссылки.
+type Local struct {
+	roots map[string]string
+}
+
+// NewLocal создаёт backend с корневыми каталогами по имени. Пути корней
+// приводятся к абсолютным без символических ссылок, чтобы с ними можно было
+// сравнивать пути файлов.
+func NewLocal(roots map[string]string) (*Local, error) {
+	resolved := make(map[string]string, len(roots))
+	for name, root := range roots {
+		path, err := filepath.Abs(root)
+		if err == nil {
+			path, err = filepath.EvalSymlinks(path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid local root %q: %w", name, err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local root %q: %w", name, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("invalid local root %q: %s is not a directory", name, path)
+		}
+
+		resolved[name] = path
+	}
+
+	return &Local{roots: resolved}, nil
+}
+
+// Open открывает файл, на который указывает imageURL.
+func (l *Local) Open(_ context.Context, imageURL *url.URL) (io.ReadCloser, error) {
+	root, ok := l.roots[imageURL.Host]
+	if !ok {
+		return nil, &Error{
+			Message:    fmt.Sprintf("unknown local root: %q", imageURL.Host),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+
+	path, err := resolvePath(root, imageURL.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fileError(err)
+	}
+
+	// Компонент пути могли подменить символической ссылкой между проверкой и
+	// открытием, поэтому корень проверяется ещё раз по открытому файлу.
+	opened, err := openedPath(file)
+	if err != nil {
+		file.Close()
+		return nil, fileError(err)
+	}
+	if !withinRoot(root, opened) {
+		file.Close()
+		return nil, outsideRootError()
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fileError(err)
+	}
+	if !info.Mode().IsRegular() {
+		file.Close()
+		return nil, &Error{
+			Message:    "source is not a file",
+			StatusCode: http.StatusNotFound,
+		}
+	}
+
+	return file, nil
+}
+
+// resolvePath возвращает путь файла внутри root. Путь проверяется до и после
+// раскрытия символических ссылок: ".." отклоняется независимо от того,
+// существует ли файл снаружи, а ссылка наружу - после раскрытия. Open
+// дополнительно проверяет путь уже открытого файла.
+func resolvePath(root, urlPath string) (string, error) {
+	path := filepath.Join(root, filepath.FromSlash(urlPath))
+	if !withinRoot(root, path) {
+		return "", outsideRootError()
+	}
+
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fileError(err)
+	}
+	if !withinRoot(root, path) {
+		return "", outsideRootError()
+	}
+
+	return path, nil
+}
+
+func withinRoot(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func outsideRootError() *Error {
+	return &Error{
+		Message:    "source path is outside of the local root",
+		StatusCode: http.StatusForbidden,
+	}
+}
+
+// fileError переводит ошибку файловой системы в ответ. Путь к файлу в
+// сообщение не попадает, чтобы не раскрывать расположение корня.
+func fileError(err error) *Error {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syscall.ENOTDIR):
+		return &Error{Message: "source file not found", StatusCode: http.StatusNotFound}
+	case errors.Is(err, fs.ErrPermission):
+		return &Error{Message: "access to source file denied", StatusCode: http.StatusForbidden}
+	}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.Err
+	}
+
+	return &Error{
+		Message:    fmt.Sprintf("failed to open source file: %s", err),
+		StatusCode: http.StatusInternalServerError,
+	}
+}
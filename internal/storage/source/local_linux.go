@@ -0,0 +1,15 @@
+//go:build linux
+
+package source
+
+import (
+	"os"
+	"strconv"
+)
+
+// openedPath возвращает настоящий путь открытого файла. Ядро хранит его для
+// дескриптора, поэтому подмена компонентов пути после открытия на результат
+// не влияет.
+func openedPath(file *os.File) (string, error) {
+	return os.Readlink("/proc/self/fd/" + strconv.Itoa(int(file.Fd())))
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+
+package source
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// openedPath возвращает путь открытого файла. Путь дескриптора здесь
+// недоступен, поэтому путь раскрывается заново и должен указывать на тот же
+// файл, что был открыт.
+func openedPath(file *os.File) (string, error) {
+	path, err := filepath.EvalSymlinks(file.Name())
+	if err != nil {
+		return "", err
+	}
+
+	opened, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !os.SameFile(opened, current) {
+		return "", errors.New("source file changed while opening")
+	}
+
+	return path, nil
+}
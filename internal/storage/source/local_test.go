@@ -0,0 +1,101 @@
+package source
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocal(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "assets")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "photos"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "photos", "a.jpg"), []byte("inside"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(base, "secret.jpg"), []byte("outside"), 0o600))
+	require.NoError(t, os.Symlink(filepath.Join(root, "photos", "a.jpg"), filepath.Join(root, "alias.jpg")))
+	require.NoError(t, os.Symlink(filepath.Join(base, "secret.jpg"), filepath.Join(root, "escape.jpg")))
+	require.NoError(t, os.Symlink(base, filepath.Join(root, "parent")))
+
+	// Корень сам может быть символической ссылкой.
+	link := filepath.Join(base, "link")
+	require.NoError(t, os.Symlink(root, link))
+
+	local, err := NewLocal(map[string]string{"assets": link})
+	require.NoError(t, err)
+
+	open := func(t *testing.T, rawURL string) (string, error) {
+		t.Helper()
+
+		imageURL, err := url.Parse(rawURL)
+		require.NoError(t, err)
+
+		file, err := local.Open(context.Background(), imageURL)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		require.NoError(t, err)
+		return string(data), nil
+	}
+
+	t.Run("files inside root", func(t *testing.T) {
+		for _, rawURL := range []string{
+			"file://assets/photos/a.jpg",
+			"file://assets/alias.jpg",
+			"file://assets/photos/../photos/a.jpg",
+		} {
+			data, err := open(t, rawURL)
+			require.NoError(t, err, rawURL)
+			assert.Equal(t, "inside", data)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for rawURL, status := range map[string]int{
+			"file://assets/../secret.jpg":        http.StatusForbidden,
+			"file://assets/%2e%2e/secret.jpg":    http.StatusForbidden,
+			"file://assets/escape.jpg":           http.StatusForbidden,
+			"file://assets/parent/secret.jpg":    http.StatusForbidden,
+			"file://assets/photos/missing.jpg":   http.StatusNotFound,
+			"file://assets/photos":               http.StatusNotFound,
+			"file://unknown/photos/a.jpg":        http.StatusBadRequest,
+			"file://assets/../../../etc/passwd":  http.StatusForbidden,
+			"file://assets/photos/a.jpg/nothing": http.StatusNotFound,
+		} {
+			_, err := open(t, rawURL)
+
+			var srcErr *Error
+			require.ErrorAs(t, err, &srcErr, rawURL)
+			assert.Equal(t, status, srcErr.StatusCode, rawURL)
+			assert.NotContains(t, srcErr.Message, base, rawURL)
+		}
+	})
+
+	t.Run("opened path", func(t *testing.T) {
+		file, err := os.Open(filepath.Join(root, "alias.jpg"))
+		require.NoError(t, err)
+		defer file.Close()
+
+		// Путь открытого файла раскрыт, его и сверяет Open с корнем.
+		opened, err := openedPath(file)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(local.roots["assets"], "photos", "a.jpg"), opened)
+	})
+
+	t.Run("invalid root", func(t *testing.T) {
+		_, err := NewLocal(map[string]string{"missing": filepath.Join(base, "missing")})
+		assert.Error(t, err)
+
+		_, err = NewLocal(map[string]string{"file": filepath.Join(base, "secret.jpg")})
+		assert.Error(t, err)
+	})
+}
@@ -2,10 +2,14 @@ package source
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 
 	"github.com/IKolyas/thumbnailer/internal/core/image"
 )
@@ -27,8 +31,222 @@ func (e *Error) Code() int {
 	return e.StatusCode
 }
 
-func Get(ctx context.Context, imgData *image.ImgData) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", imgData.ImageURL, nil)
+// Backend открывает исходники с одной схемой URL. Ошибки возвращаются как
+// *Error со статусом ответа.
+type Backend interface {
+	Open(ctx context.Context, imageURL *url.URL) (io.ReadCloser, error)
+}
+
+// Source загружает исходные изображения и обрабатывает их.
+type Source struct {
+	client  *http.Client
+	maxSize int64
+	options image.Options
+	// backends - загрузчики по схеме URL. Схемы http и https обрабатывает
+	// HTTP-клиент.
+	backends map[string]Backend
+}
+
+type Option func(*Source)
+
+// WithMaxSize ограничивает размер скачиваемого файла (байт).
+func WithMaxSize(size int64) Option {
+	return func(s *Source) {
+		s.maxSize = size
+	}
+}
+
+// WithLimits ограничивает размеры исходного изображения.
+func WithLimits(limits image.Limits) Option {
+	return func(s *Source) {
+		s.options.Limits = limits
+	}
+}
+
+// WithColorProfile задаёт целевой ICC-профиль результата. Пустой путь
+// означает sRGB, embed встраивает профиль в результат.
+func WithColorProfile(path string, embed bool) Option {
+	return func(s *Source) {
+		s.options.Profile = path
+		s.options.EmbedProfile = embed
+	}
+}
+
+// WithWatermarks задаёт реестр водяных знаков.
+func WithWatermarks(watermarks map[string]*image.Watermark) Option {
+	return func(s *Source) {
+		s.options.Watermarks = watermarks
+	}
+}
+
+// WithBackend регистрирует backend для схемы URL, например LocalScheme.
+func WithBackend(scheme string, backend Backend) Option {
+	return func(s *Source) {
+		s.backends[scheme] = backend
+	}
+}
+
+// WithTextStyles задаёт реестр стилей текста.
+func WithTextStyles(styles map[string]image.TextStyle) Option {
+	return func(s *Source) {
+		s.options.TextStyles = styles
+	}
+}
+
+func New(opts ...Option) *Source {
+	src := &Source{
+		client:   http.DefaultClient,
+		backends: make(map[string]Backend),
+	}
+
+	for _, opt := range opts {
+		opt(src)
+	}
+
+	return src
+}
+
+func (s *Source) Get(ctx context.Context, imgData *image.ImgData) ([]byte, error) {
+	data, err := s.fetch(ctx, imgData.ImageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	vipsImg, err := image.Load(data, imgData.Frame)
+	if err != nil {
+		return nil, &Error{
+			Message:    fmt.Sprintf("failed to create vips image: %s", err),
+			StatusCode: statusFromError(err),
+		}
+	}
+
+	if err := vipsImg.CheckLimits(s.options.Limits); err != nil {
+		return nil, &Error{
+			Message:    err.Error(),
+			StatusCode: statusFromError(err),
+		}
+	}
+
+	var res []byte
+	switch imgData.Action {
+	case image.ImageActionFill, image.ImageActionCrop:
+		res, err = vipsImg.Process(imgData, s.options)
+	case image.ImageActionBlurHash:
+		var hash string
+		hash, err = vipsImg.BlurHash()
+		res = []byte(hash)
+	case image.ImageActionLQIP:
+		var uri string
+		uri, err = vipsImg.LQIP(imgData.Width)
+		res = []byte(uri)
+	case image.ImageActionInfo:
+		var info *image.Info
+		if info, err = vipsImg.Info(len(data), imgData.Colors); err == nil {
+			res, err = json.Marshal(info)
+		}
+	default:
+		return nil, &Error{
+			Message:    "action not allowed",
+			StatusCode: http.StatusMethodNotAllowed,
+		}
+	}
+
+	if err != nil {
+		return nil, &Error{
+			Message:    fmt.Sprintf("failed to process image: %s", err),
+			StatusCode: statusFromError(err),
+		}
+	}
+
+	return res, nil
+}
+
+// sharedDownloadKey - ключ контекста с общими загрузками.
+type sharedDownloadKey struct{}
+
+// sharedDownloads хранит результаты загрузок в пределах одного контекста.
+type sharedDownloads struct {
+	mu      sync.Mutex
+	results map[string]downloadResult
+}
+
+type downloadResult struct {
+	data []byte
+	err  error
+}
+
+// WithSharedDownload возвращает контекст, в котором каждый URL скачивается
+// не больше одного раза: параллельные запросы ждут первую загрузку и
+// получают её результат. Используется при обработке нескольких вариантов
+// одного исходника.
+func WithSharedDownload(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sharedDownloadKey{}, &sharedDownloads{results: make(map[string]downloadResult)})
+}
+
+func (s *Source) fetch(ctx context.Context, imageURL string) ([]byte, error) {
+	shared, ok := ctx.Value(sharedDownloadKey{}).(*sharedDownloads)
+	if !ok {
+		return s.download(ctx, imageURL)
+	}
+
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+
+	if result, ok := shared.results[imageURL]; ok {
+		return result.data, result.err
+	}
+
+	data, err := s.download(ctx, imageURL)
+	shared.results[imageURL] = downloadResult{data: data, err: err}
+
+	return data, err
+}
+
+// download выбирает загрузчик по схеме URL. Тип содержимого локальных
+// файлов определяется по сигнатуре, так как заголовка Content-Type нет.
+func (s *Source) download(ctx context.Context, imageURL string) ([]byte, error) {
+	parsed, err := url.Parse(imageURL)
+	if err != nil {
+		return nil, &Error{
+			Message:    fmt.Sprintf("invalid source URL: %s", err),
+			StatusCode: http.StatusBadRequest,
+		}
+	}
+
+	backend, ok := s.backends[parsed.Scheme]
+	if !ok {
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, &Error{
+				Message:    fmt.Sprintf("unsupported source scheme: %q", parsed.Scheme),
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+		return s.downloadHTTP(ctx, imageURL)
+	}
+
+	body, err := backend.Open(ctx, parsed)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := s.readBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(image.ContentType(data), "image/") {
+		return nil, &Error{
+			Message:    "file is not an image",
+			StatusCode: http.StatusUnsupportedMediaType,
+		}
+	}
+
+	return data, nil
+}
+
+func (s *Source) downloadHTTP(ctx context.Context, imageURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
 	if err != nil {
 		return nil, &Error{
 			Message:    fmt.Sprintf("failed to create request: %s", err),
@@ -45,7 +263,7 @@ func Get(ctx context.Context, imgData *image.ImgData) ([]byte, error) {
 	}
 	req.Header = headers
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
 		return nil, &Error{
 			Message:    fmt.Sprintf("failed to download image: %s", err),
@@ -69,7 +287,21 @@ func Get(ctx context.Context, imgData *image.ImgData) ([]byte, error) {
 		}
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	if s.maxSize > 0 && resp.ContentLength > s.maxSize {
+		return nil, tooLargeError(s.maxSize)
+	}
+
+	return s.readBody(resp.Body)
+}
+
+// readBody читает тело ответа, не доверяя Content-Length: сервер может
+// его не указать или указать неверно.
+func (s *Source) readBody(body io.Reader) ([]byte, error) {
+	if s.maxSize > 0 {
+		body = io.LimitReader(body, s.maxSize+1)
+	}
+
+	data, err := io.ReadAll(body)
 	if err != nil {
 		return nil, &Error{
 			Message:    fmt.Sprintf("failed to read image data: %s", err),
@@ -77,28 +309,24 @@ func Get(ctx context.Context, imgData *image.ImgData) ([]byte, error) {
 		}
 	}
 
-	vipsImg, err := image.NewImage(data)
-	if err != nil {
-		return nil, &Error{
-			Message:    fmt.Sprintf("failed to create vips image: %s", err),
-			StatusCode: http.StatusInternalServerError,
-		}
+	if s.maxSize > 0 && int64(len(data)) > s.maxSize {
+		return nil, tooLargeError(s.maxSize)
 	}
 
-	switch imgData.Action {
-	case image.ImageActionFill:
-		res, err := vipsImg.Fill(imgData)
-		if err != nil {
-			return nil, &Error{
-				Message:    fmt.Sprintf("failed to create vips image: %s", err),
-				StatusCode: http.StatusInternalServerError,
-			}
-		}
-		return res, nil
-	default:
-		return nil, &Error{
-			Message:    "action not allowed",
-			StatusCode: http.StatusMethodNotAllowed,
-		}
+	return data, nil
+}
+
+func tooLargeError(maxSize int64) *Error {
+	return &Error{
+		Message:    fmt.Sprintf("source image exceeds maximum size of %d bytes", maxSize),
+		StatusCode: http.StatusRequestEntityTooLarge,
+	}
+}
+
+func statusFromError(err error) int {
+	if errors.Is(err, image.ErrLimitExceeded) || errors.Is(err, image.ErrOutOfBounds) ||
+		errors.Is(err, image.ErrUnsupported) {
+		return http.StatusUnprocessableEntity
 	}
+	return http.StatusInternalServerError
 }